@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -10,7 +11,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
@@ -22,6 +25,7 @@ import (
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/auth"
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/messagebus"
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/redis"
 	"golang.org/x/sys/unix"
 )
@@ -29,6 +33,9 @@ import (
 type messageBus interface {
 	datastore.Updater
 	auth.LogoutEventer
+
+	LastAutoupdateID() string
+	ResumeAutoupdate(ctx context.Context, id string) (map[string][]byte, error)
 }
 
 func main() {
@@ -46,9 +53,13 @@ func defaultEnv() map[string]string {
 		"DATASTORE_READER_PORT":     "9010",
 		"DATASTORE_READER_PROTOCOL": "http",
 
-		"MESSAGE_BUS_HOST": "localhost",
-		"MESSAGE_BUS_PORT": "6379",
-		"REDIS_TEST_CONN":  "true",
+		"MESSAGE_BUS":         "redis",
+		"MESSAGE_BUS_HOST":    "localhost",
+		"MESSAGE_BUS_PORT":    "6379",
+		"MESSAGE_BUS_SOCKET":  "",
+		"MESSAGE_BUS_ID_FILE": "",
+		"MESSAGE_BUS_ID_KEY":  "",
+		"REDIS_TEST_CONN":     "true",
 
 		"VOTE_HOST":     "localhost",
 		"VOTE_PORT":     "9013",
@@ -59,8 +70,35 @@ func defaultEnv() map[string]string {
 		"AUTH_HOST":     "localhost",
 		"AUTH_PORT":     "9004",
 
-		"OPENSLIDES_DEVELOPMENT":  "false",
-		"METRIC_INTERVAL_SECONDS": "300",
+		"OPENSLIDES_DEVELOPMENT":     "false",
+		"METRIC_INTERVAL_SECONDS":    "300",
+		"KEEPALIVE_INTERVAL_SECONDS": "30",
+
+		"CONNECTION_LIMIT_PER_USER":        "0",
+		"CONNECTION_LIMIT_PER_IP":          "0",
+		"CONNECTION_LIMIT_GLOBAL":          "0",
+		"CONNECTION_LIMIT_TRUSTED_PROXIES": "",
+
+		"WEBSOCKET_ALLOWED_ORIGINS": "",
+
+		"DATASTORE_CACHE_SIZE_MB":     "0",
+		"DATASTORE_CACHE_RESET_HOURS": "24",
+		"DATASTORE_SNAPSHOT_FILE":     "",
+		"DATASTORE_BATCH_WAIT_MS":     "2",
+		"DATASTORE_BATCH_MAX_KEYS":    "1000",
+
+		"DATASTORE_FILE":          "",
+		"DATASTORE_FILE_WATCH_MS": "1000",
+		"DATASTORE_FILE_UPDATES":  "",
+
+		"DATASTORE_READER_TIMEOUT_MS":          "3000",
+		"DATASTORE_READER_RETRIES":             "3",
+		"DATASTORE_READER_RETRY_BACKOFF_MS":    "100",
+		"DATASTORE_READER_BREAKER_THRESHOLD":   "5",
+		"DATASTORE_READER_BREAKER_COOLDOWN_MS": "5000",
+
+		"SHUTDOWN_TIMEOUT_SECONDS":         "30",
+		"SHUTDOWN_RECONNECT_DELAY_SECONDS": "10",
 	}
 
 	for k := range defaults {
@@ -109,7 +147,7 @@ func run() error {
 	defer cancel()
 
 	// Receiver for datastore and logout events.
-	messageBus, err := buildMessagebus(env)
+	messageBus, err := buildMessagebus(ctx, env)
 	if err != nil {
 		return fmt.Errorf("creating messsaging adapter: %w", err)
 	}
@@ -119,7 +157,34 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("creating datastore adapter: %w", err)
 	}
-	go datastoreService.ListenOnUpdates(ctx, errHandler)
+
+	// The snapshot needs the position of the message bus. It is not used with
+	// the file source. The ids of the socket message bus only exist as long as
+	// the process, so its snapshot could not be resumed.
+	snapshotFile := env["DATASTORE_SNAPSHOT_FILE"]
+	if env["DATASTORE_FILE"] != "" {
+		snapshotFile = ""
+	}
+
+	if snapshotFile != "" && env["MESSAGE_BUS"] != "redis" {
+		log.Printf("DATASTORE_SNAPSHOT_FILE is ignored: the message bus %s can not be resumed after a restart", env["MESSAGE_BUS"])
+		snapshotFile = ""
+	}
+
+	var snapshotID string
+	if snapshotFile != "" {
+		id, err := loadSnapshot(ctx, snapshotFile, datastoreService, messageBus)
+		if err != nil {
+			log.Printf("Can not load datastore snapshot: %v", err)
+		}
+		snapshotID = id
+	}
+
+	listenDone := make(chan struct{})
+	go func() {
+		defer close(listenDone)
+		datastoreService.ListenOnUpdates(ctx, errHandler)
+	}()
 
 	// Auth Service.
 	authService, err := buildAuth(ctx, env, messageBus, errHandler)
@@ -132,22 +197,61 @@ func run() error {
 	// Autoupdate Service.
 	service := autoupdate.New(datastoreService, restrict.Middleware, voteAddr)
 	go service.PruneOldData(ctx)
-	go service.ResetCache(ctx)
+
+	cacheResetHours, err := strconv.Atoi(env["DATASTORE_CACHE_RESET_HOURS"])
+	if err != nil {
+		return fmt.Errorf("invalid value for DATASTORE_CACHE_RESET_HOURS: %w", err)
+	}
+	if cacheResetHours > 0 {
+		go service.ResetCache(ctx, time.Duration(cacheResetHours)*time.Hour)
+	}
 
 	// Create http mux to add urls.
 	mux := http.NewServeMux()
 
 	requestCount := new(metric.CurrentCounter)
 
-	autoupdateHttp.Health(mux)
-	autoupdateHttp.Autoupdate(mux, authService, service, requestCount)
+	keepaliveSeconds, err := strconv.Atoi(env["KEEPALIVE_INTERVAL_SECONDS"])
+	if err != nil {
+		return fmt.Errorf("invalid value for KEEPALIVE_INTERVAL_SECONDS: %w", err)
+	}
+
+	limiter, err := buildLimiter(env)
+	if err != nil {
+		return fmt.Errorf("creating connection limiter: %w", err)
+	}
+
+	reconnectDelaySeconds, err := strconv.Atoi(env["SHUTDOWN_RECONNECT_DELAY_SECONDS"])
+	if err != nil {
+		return fmt.Errorf("invalid value for SHUTDOWN_RECONNECT_DELAY_SECONDS: %w", err)
+	}
+	drainer := autoupdateHttp.NewDrainer(time.Duration(reconnectDelaySeconds) * time.Second)
+
+	autoupdateHttp.Health(mux, datastoreService)
+	autoupdateHttp.Autoupdate(mux, authService, service, requestCount, limiter, drainer, time.Duration(keepaliveSeconds)*time.Second)
+	var allowedOrigins []string
+	if origins := env["WEBSOCKET_ALLOWED_ORIGINS"]; origins != "" {
+		allowedOrigins = strings.Split(origins, ",")
+	}
+	autoupdateHttp.Websocket(mux, authService, service, requestCount, limiter, drainer, allowedOrigins)
+
+	// The internal route is only available, if the secret exists. There is no
+	// default, not even in development mode.
+	if internalSecret, err := openSecret("internal_auth_password"); err == nil && internalSecret != "" {
+		autoupdateHttp.InternalAutoupdate(mux, internalSecret, service, service.Unrestricted(), drainer, time.Duration(keepaliveSeconds)*time.Second)
+	} else {
+		fmt.Println("Internal autoupdate route disabled: no secret internal_auth_password")
+	}
 	autoupdateHttp.HistoryInformation(mux, authService, service)
+	autoupdateHttp.FieldHistory(mux, authService, service)
+	autoupdateHttp.Changes(mux, authService, service)
 
 	// Projector Service.
 	projector.Register(datastoreService, slide.Slides())
 
 	// Start metrics.
 	metric.Register(requestCount.Metric)
+	metric.Register(limiter.Metric)
 	metric.Register(runtimeMetrics)
 	metricSeconds := 0
 	if got, err := strconv.Atoi(env["METRIC_INTERVAL_SECONDS"]); err == nil {
@@ -160,20 +264,46 @@ func run() error {
 	// Create http server.
 	listenAddr := ":" + env["AUTOUPDATE_PORT"]
 
+	// The requests get their own context. It is canceled after the open
+	// streams were drained.
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
 		Addr:        listenAddr,
 		Handler:     mux,
-		BaseContext: func(net.Listener) context.Context { return ctx },
+		BaseContext: func(net.Listener) context.Context { return requestCtx },
+	}
+
+	shutdownSeconds, err := strconv.Atoi(env["SHUTDOWN_TIMEOUT_SECONDS"])
+	if err != nil {
+		return fmt.Errorf("invalid value for SHUTDOWN_TIMEOUT_SECONDS: %w", err)
 	}
 
 	// Shutdown logic in separate goroutine.
 	wait := make(chan error)
 	go func() {
 		<-ctx.Done()
-		if err := srv.Shutdown(context.Background()); err != nil {
+		defer cancelRequests()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownSeconds)*time.Second)
+		defer cancel()
+
+		// Tell the open streams to reconnect, while the server stops accepting
+		// new connections. Websocket connections are not tracked by the
+		// server, so the drainer has to wait for them.
+		drained := make(chan error, 1)
+		go func() { drained <- drainer.Drain(shutdownCtx) }()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
 			wait <- fmt.Errorf("HTTP server shutdown: %w", err)
 			return
 		}
+
+		if err := <-drained; err != nil {
+			wait <- fmt.Errorf("draining streams: %w", err)
+			return
+		}
 		wait <- nil
 	}()
 
@@ -182,7 +312,104 @@ func run() error {
 		return fmt.Errorf("HTTP Server failed: %v", err)
 	}
 
-	return <-wait
+	shutdownErr := <-wait
+
+	if snapshotFile != "" {
+		// Wait until all received updates are in the cache.
+		<-listenDone
+		if err := saveSnapshot(snapshotFile, datastoreService, messageBus, snapshotID); err != nil {
+			log.Printf("Can not save datastore snapshot: %v", err)
+		}
+	}
+
+	return shutdownErr
+}
+
+// loadSnapshot loads the datastore cache from a snapshot file.
+//
+// The file starts with the id of the last message from the message bus,
+// followed by a newline. The message bus resumes from this id. All updates,
+// that happened since then, are applied to the snapshot.
+//
+// Returns the id of the loaded snapshot. It is no error, if the file does not
+// exist.
+func loadSnapshot(ctx context.Context, path string, ds *datastore.Datastore, mb messageBus) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("open snapshot file: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	id, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("reading message bus id: %w", err)
+	}
+	id = strings.TrimSpace(id)
+
+	changes, err := mb.ResumeAutoupdate(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("resuming message bus: %w", err)
+	}
+
+	if err := ds.LoadSnapshot(r, changes); err != nil {
+		return "", fmt.Errorf("loading snapshot: %w", err)
+	}
+
+	fmt.Printf("Datastore cache loaded from %s\n", path)
+	return id, nil
+}
+
+// saveSnapshot writes the datastore cache to a snapshot file.
+//
+// If no message was received from the message bus, the snapshot gets the id of
+// the loaded snapshot. loadedID is empty, if no snapshot was loaded.
+//
+// Has to be called after the datastore stopped listening on updates.
+func saveSnapshot(path string, ds *datastore.Datastore, mb messageBus, loadedID string) error {
+	id := mb.LastAutoupdateID()
+	if id == "" {
+		id = loadedID
+	}
+
+	if id == "" {
+		return fmt.Errorf("no message was received from the message bus")
+	}
+
+	// Write to a temporary file first, so an old snapshot is not destroyed,
+	// when writing fails.
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("creating snapshot file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if _, err := fmt.Fprintln(w, id); err != nil {
+		return fmt.Errorf("writing message bus id: %w", err)
+	}
+
+	if err := ds.WriteSnapshot(w); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing snapshot file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("replacing snapshot file: %w", err)
+	}
+	return nil
 }
 
 // interruptContext works like signal.NotifyContext
@@ -206,7 +433,47 @@ func interruptContext() (context.Context, context.CancelFunc) {
 
 // buildDatastore configures the datastore service.
 func buildDatastore(env map[string]string, mb messageBus) (*datastore.Datastore, error) {
-	datastoreSource := datastore.NewSourceDatastore(env["DATASTORE_READER_PROTOCOL"]+"://"+env["DATASTORE_READER_HOST"]+":"+env["DATASTORE_READER_PORT"], mb)
+	cacheSizeMB, err := strconv.Atoi(env["DATASTORE_CACHE_SIZE_MB"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for DATASTORE_CACHE_SIZE_MB: %w", err)
+	}
+
+	if env["DATASTORE_FILE"] != "" {
+		fileSource, err := buildFileSource(env, mb)
+		if err != nil {
+			return nil, fmt.Errorf("creating file source: %w", err)
+		}
+
+		return datastore.New(
+			fileSource,
+			nil,
+			fileSource,
+			datastore.WithCacheMaxSize(cacheSizeMB<<20),
+		), nil
+	}
+
+	batchWait, err := strconv.Atoi(env["DATASTORE_BATCH_WAIT_MS"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for DATASTORE_BATCH_WAIT_MS: %w", err)
+	}
+
+	batchMaxKeys, err := strconv.Atoi(env["DATASTORE_BATCH_MAX_KEYS"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for DATASTORE_BATCH_MAX_KEYS: %w", err)
+	}
+
+	var sourceOptions []datastore.SourceOption
+	if batchWait > 0 {
+		sourceOptions = append(sourceOptions, datastore.WithBatching(time.Duration(batchWait)*time.Millisecond, batchMaxKeys))
+	}
+
+	readerOptions, err := buildReaderOptions(env)
+	if err != nil {
+		return nil, fmt.Errorf("reading datastore reader config: %w", err)
+	}
+	sourceOptions = append(sourceOptions, readerOptions...)
+
+	datastoreSource := datastore.NewSourceDatastore(env["DATASTORE_READER_PROTOCOL"]+"://"+env["DATASTORE_READER_HOST"]+":"+env["DATASTORE_READER_PORT"], mb, sourceOptions...)
 	voteCountSource := datastore.NewVoteCountSource(env["VOTE_PROTOCAL"] + "://" + env["VOTE_HOST"] + ":" + env["VOTE_PORT"])
 
 	return datastore.New(
@@ -215,22 +482,196 @@ func buildDatastore(env map[string]string, mb messageBus) (*datastore.Datastore,
 			"poll/vote_count": voteCountSource,
 		},
 		datastoreSource,
+		datastore.WithCacheMaxSize(cacheSizeMB<<20),
 	), nil
 }
 
+// buildFileSource returns a datastore source, that reads the data from a file
+// instead of the datastore reader and redis.
+//
+// The vote service is also not used. The vote count of polls is always
+// missing.
+func buildFileSource(env map[string]string, mb messageBus) (*datastore.SourceFile, error) {
+	watchMS, err := strconv.Atoi(env["DATASTORE_FILE_WATCH_MS"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for DATASTORE_FILE_WATCH_MS: %w", err)
+	}
+
+	var options []datastore.FileOption
+	if watchMS > 0 {
+		options = append(options, datastore.WithFileWatch(time.Duration(watchMS)*time.Millisecond))
+	}
+
+	if updatePath := env["DATASTORE_FILE_UPDATES"]; updatePath != "" {
+		// Open the pipe for reading and writing. Opening a named pipe only
+		// for reading blocks until there is a writer and every writer, that
+		// closes the pipe, would end the reading.
+		f, err := os.OpenFile(updatePath, os.O_RDWR, 0)
+		if err != nil {
+			return nil, fmt.Errorf("open update file: %w", err)
+		}
+		options = append(options, datastore.WithUpdateReader(f))
+	}
+
+	// The redis bus is only used for the logout events. The other message
+	// buses can also send changes to the file data.
+	if env["MESSAGE_BUS"] != "redis" {
+		options = append(options, datastore.WithUpdater(mb))
+	}
+
+	fmt.Printf("Datastore: file %s\n", env["DATASTORE_FILE"])
+	return datastore.NewSourceFile(env["DATASTORE_FILE"], options...)
+}
+
+// buildReaderOptions returns the options for the timeout, the retries and the
+// circuit breaker of the datastore reader.
+func buildReaderOptions(env map[string]string) ([]datastore.SourceOption, error) {
+	values := make(map[string]int)
+	for _, name := range []string{
+		"DATASTORE_READER_TIMEOUT_MS",
+		"DATASTORE_READER_RETRIES",
+		"DATASTORE_READER_RETRY_BACKOFF_MS",
+		"DATASTORE_READER_BREAKER_THRESHOLD",
+		"DATASTORE_READER_BREAKER_COOLDOWN_MS",
+	} {
+		v, err := strconv.Atoi(env[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		values[name] = v
+	}
+
+	options := []datastore.SourceOption{
+		datastore.WithTimeout(time.Duration(values["DATASTORE_READER_TIMEOUT_MS"]) * time.Millisecond),
+	}
+
+	if retries := values["DATASTORE_READER_RETRIES"]; retries > 0 {
+		backoff := time.Duration(values["DATASTORE_READER_RETRY_BACKOFF_MS"]) * time.Millisecond
+		options = append(options, datastore.WithRetry(retries+1, backoff))
+	}
+
+	if threshold := values["DATASTORE_READER_BREAKER_THRESHOLD"]; threshold > 0 {
+		cooldown := time.Duration(values["DATASTORE_READER_BREAKER_COOLDOWN_MS"]) * time.Millisecond
+		options = append(options, datastore.WithCircuitBreaker(threshold, cooldown))
+	}
+
+	return options, nil
+}
+
 // buildMessagebus builds the receiver needed by the datastore service. It uses
-// environment variables to make the decission. Per default, the given faker is
-// used.
-func buildMessagebus(env map[string]string) (messageBus, error) {
-	redisAddress := env["MESSAGE_BUS_HOST"] + ":" + env["MESSAGE_BUS_PORT"]
-	conn := redis.NewConnection(redisAddress)
-	if env["REDIS_TEST_CONN"] == "true" {
-		if err := conn.TestConn(); err != nil {
-			return nil, fmt.Errorf("connect to redis: %w", err)
+// the environment variable MESSAGE_BUS to make the decission. Per default,
+// redis is used.
+//
+// The context is used to stop the unix socket.
+func buildMessagebus(ctx context.Context, env map[string]string) (messageBus, error) {
+	switch env["MESSAGE_BUS"] {
+	case "redis":
+		redisAddress := env["MESSAGE_BUS_HOST"] + ":" + env["MESSAGE_BUS_PORT"]
+		conn := redis.NewConnection(redisAddress)
+
+		// With the file source, redis is only needed for the auth service.
+		if env["REDIS_TEST_CONN"] == "true" && env["DATASTORE_FILE"] == "" {
+			if err := conn.TestConn(); err != nil {
+				return nil, fmt.Errorf("connect to redis: %w", err)
+			}
+		}
+
+		idStore, err := buildIDStore(env, conn)
+		if err != nil {
+			return nil, fmt.Errorf("creating id store: %w", err)
+		}
+
+		return &redis.Redis{Conn: conn, IDStore: idStore}, nil
+
+	case "socket":
+		path := env["MESSAGE_BUS_SOCKET"]
+		if path == "" {
+			return nil, fmt.Errorf("MESSAGE_BUS_SOCKET is needed for the message bus socket")
+		}
+
+		fmt.Printf("Message Bus: unix socket %s\n", path)
+		bus := messagebus.NewMemory()
+		listener, err := messagebus.ListenSocket(path, bus)
+		if err != nil {
+			return nil, fmt.Errorf("creating message bus socket: %w", err)
+		}
+
+		go func() {
+			if err := listener.Serve(ctx, errHandler); err != nil {
+				log.Printf("Message bus socket stopped: %v", err)
+			}
+		}()
+		return bus, nil
+
+	default:
+		return nil, fmt.Errorf("unknown message bus %s", env["MESSAGE_BUS"])
+	}
+}
+
+// buildIDStore returns the store for the id of the last redis message. It
+// returns nil, if the id should not be saved.
+func buildIDStore(env map[string]string, conn *redis.Pool) (redis.IDStore, error) {
+	file := env["MESSAGE_BUS_ID_FILE"]
+	key := env["MESSAGE_BUS_ID_KEY"]
+
+	switch {
+	case file != "" && key != "":
+		return nil, fmt.Errorf("MESSAGE_BUS_ID_FILE and MESSAGE_BUS_ID_KEY can not be used together")
+	case file != "":
+		return redis.FileIDStore{Path: file}, nil
+	case key != "":
+		return redis.KeyIDStore{Conn: conn, Key: key}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// buildLimiter returns the connection limiter for the http server.
+func buildLimiter(env map[string]string) (*autoupdateHttp.ConnectionLimiter, error) {
+	var limits [3]int
+	for i, name := range []string{"CONNECTION_LIMIT_PER_USER", "CONNECTION_LIMIT_PER_IP", "CONNECTION_LIMIT_GLOBAL"} {
+		limit, err := strconv.Atoi(env[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		limits[i] = limit
+	}
+
+	var trustedProxies []*net.IPNet
+	if proxies := env["CONNECTION_LIMIT_TRUSTED_PROXIES"]; proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			network, err := parseNetwork(strings.TrimSpace(proxy))
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for CONNECTION_LIMIT_TRUSTED_PROXIES: %w", err)
+			}
+			trustedProxies = append(trustedProxies, network)
 		}
 	}
 
-	return &redis.Redis{Conn: conn}, nil
+	return autoupdateHttp.NewConnectionLimiter(limits[0], limits[1], limits[2], trustedProxies), nil
+}
+
+// parseNetwork parses an ip address or a network in CIDR notation. An ip
+// address is returned as network, that only contains this address.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing network: %w", err)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address %s", value)
+	}
+
+	bits := 8 * net.IPv4len
+	if ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
 }
 
 // buildAuth returns the auth service needed by the http server.
@@ -284,16 +725,22 @@ func buildAuth(
 	}
 }
 
+// secretsPath is the directory of the secret files.
+var secretsPath = "/run/secrets"
+
+// openSecret reads a secret file. Whitespace around the secret, like a newline
+// at the end of the file, is removed.
 func openSecret(name string) (string, error) {
-	f, err := os.Open("/run/secrets/" + name)
+	f, err := os.Open(filepath.Join(secretsPath, name))
 	if err != nil {
 		return "", err
 	}
+	defer f.Close()
 
 	secret, err := io.ReadAll(f)
 	if err != nil {
-		return "", fmt.Errorf("reading `/run/secrets/%s`: %w", name, err)
+		return "", fmt.Errorf("reading `%s`: %w", filepath.Join(secretsPath, name), err)
 	}
 
-	return string(secret), nil
+	return strings.TrimSpace(string(secret)), nil
 }
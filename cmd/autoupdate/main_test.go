@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/dsmock"
+)
+
+func TestSecretWithNewline(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "auth_token_key"), []byte("my secret\n"), 0o600); err != nil {
+		t.Fatalf("writing secret file: %v", err)
+	}
+
+	oldPath := secretsPath
+	secretsPath = dir
+	defer func() { secretsPath = oldPath }()
+
+	got, err := secret("auth_token_key", false)
+	if err != nil {
+		t.Fatalf("secret: %v", err)
+	}
+
+	if got != "my secret" {
+		t.Errorf("Got secret %q, expected %q", got, "my secret")
+	}
+}
+
+// idBus is a message bus that never receives a message.
+type idBus struct {
+	lastID string
+}
+
+func (b *idBus) Update(ctx context.Context) (map[string][]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *idBus) LogoutEvent(ctx context.Context) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *idBus) LastAutoupdateID() string {
+	return b.lastID
+}
+
+func (b *idBus) ResumeAutoupdate(ctx context.Context, id string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func TestSnapshotWithoutNewMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	ds := datastore.New(dsmock.NewStubWithUpdate(nil), nil, nil)
+
+	if err := saveSnapshot(path, ds, &idBus{lastID: "12345-0"}, ""); err != nil {
+		t.Fatalf("saveSnapshot: %v", err)
+	}
+
+	loadedID, err := loadSnapshot(context.Background(), path, ds, &idBus{})
+	if err != nil {
+		t.Fatalf("loadSnapshot: %v", err)
+	}
+
+	if err := saveSnapshot(path, ds, &idBus{}, loadedID); err != nil {
+		t.Fatalf("saveSnapshot without new messages: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open snapshot: %v", err)
+	}
+	defer f.Close()
+
+	id, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading id: %v", err)
+	}
+
+	if got := strings.TrimSpace(id); got != "12345-0" {
+		t.Errorf("Snapshot has id %s, expected 12345-0", got)
+	}
+}
@@ -1,11 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"strings"
 )
 
 func main() {
@@ -30,15 +29,17 @@ func run() error {
 		return fmt.Errorf("health returned status %s", resp.Status)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("reading response body: %w", err)
+	// The response can contain more values, like the state of the datastore
+	// reader. Only the healthy flag is relevant.
+	var body struct {
+		Healthy bool `json:"healthy"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decoding response body: %w", err)
 	}
 
-	expect := `{"healthy": true}`
-	got := strings.TrimSpace(string(body))
-	if got != expect {
-		return fmt.Errorf("got `%s`, expected `%s`", body, expect)
+	if !body.Healthy {
+		return fmt.Errorf("service is not healthy")
 	}
 
 	return nil
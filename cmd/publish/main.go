@@ -0,0 +1,75 @@
+// This tool sends messages to the unix socket message bus of the autoupdate
+// service.
+//
+// The path of the socket is read from the environment variable
+// MESSAGE_BUS_SOCKET. Each argument is one message. Without arguments, the
+// messages are read from stdin, one per line. For example:
+//
+//	publish '{"modified_fields": {"topic/10/title": "ZZ"}}'
+//	publish '{"logout": ["session-id"]}'
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/messagebus"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	socket := os.Getenv("MESSAGE_BUS_SOCKET")
+	if socket == "" {
+		return fmt.Errorf("environment variable MESSAGE_BUS_SOCKET is not set")
+	}
+
+	ctx := context.Background()
+
+	if len(os.Args) > 1 {
+		for _, arg := range os.Args[1:] {
+			if err := publish(ctx, socket, arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if err := publish(ctx, socket, line); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading stdin: %w", err)
+	}
+	return nil
+}
+
+func publish(ctx context.Context, socket string, raw string) error {
+	var msg messagebus.Message
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		return fmt.Errorf("invalid message `%s`: %w", raw, err)
+	}
+
+	if err := messagebus.SendSocket(ctx, socket, msg); err != nil {
+		return fmt.Errorf("publishing message: %w", err)
+	}
+	return nil
+}
@@ -7,17 +7,15 @@
 package autoupdate
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"io"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/restrict"
-	"github.com/OpenSlides/openslides-autoupdate-service/internal/restrict/collection"
-	"github.com/OpenSlides/openslides-autoupdate-service/internal/restrict/perm"
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
 	"github.com/ostcar/topic"
 )
@@ -27,17 +25,6 @@ const (
 	// more time to process the data, it will get an error and has to reconnect.
 	// A higher value means, that more memory is used.
 	pruneTime = 10 * time.Minute
-
-	// cacheResetTime defines when the cache should be reseted.
-	//
-	// When the datastore runs for a long time, its cache grows bigger and more
-	// calculated keys have to be calculated. A reset means, that everything
-	// gets cleaned.
-	//
-	// A high value means more memory and cpu usage after some time. A lower
-	// value means more Requests to the Datastore Service and therefore a slower
-	// response time for the clients.
-	datastoreCacheResetTime = 24 * time.Hour
 )
 
 // Format of keys in the topic that shows, that a full update is necessary. It
@@ -48,10 +35,15 @@ const fullUpdateFormat = "fullupdate/%d"
 // Autoupdate holds the state of the autoupdate service. It has to be initialized
 // with autoupdate.New().
 type Autoupdate struct {
-	datastore  Datastore
-	topic      *topic.Topic[string]
-	restricter RestrictMiddleware
-	voteAddr   string
+	datastore    Datastore
+	topic        *topic.Topic[string]
+	restricter   RestrictMiddleware
+	voteAddr     string
+	unrestricted bool
+
+	// epoch is part of each message id. With it, ids from another instance
+	// or from before a restart are detected.
+	epoch string
 }
 
 // RestrictMiddleware is a function that can restrict data.
@@ -67,8 +59,13 @@ func New(datastore Datastore, restricter RestrictMiddleware, voteAddr string) *A
 		topic:      topic.New[string](),
 		restricter: restricter,
 		voteAddr:   voteAddr,
+		epoch:      strconv.FormatInt(time.Now().UnixNano(), 10),
 	}
 
+	// Make sure the topic is not empty. Otherwise the first messages would
+	// have the topic id 0, which can not be resumed.
+	a.topic.Publish()
+
 	// Update the topic when an data update is received.
 	a.datastore.RegisterChangeListener(func(data map[string][]byte) error {
 		keys := make([]string, 0, len(data))
@@ -80,12 +77,70 @@ func New(datastore Datastore, restricter RestrictMiddleware, voteAddr string) *A
 		return nil
 	})
 
+	// When the datastore missed updates, every connection has to be
+	// recalculated.
+	a.datastore.RegisterFullUpdateListener(func() {
+		a.topic.Publish(fmt.Sprintf(fullUpdateFormat, -1))
+	})
+
 	return a
 }
 
+// Unrestricted returns an Autoupdate that uses the same datastore and updates,
+// but does not restrict the data. It must only be used for trusted services.
+func (a *Autoupdate) Unrestricted() *Autoupdate {
+	return &Autoupdate{
+		datastore:    a.datastore,
+		topic:        a.topic,
+		restricter:   func(getter datastore.Getter, uid int) datastore.Getter { return getter },
+		voteAddr:     a.voteAddr,
+		unrestricted: true,
+		epoch:        a.epoch,
+	}
+}
+
 // DataProvider is a function that returns the next data for a user.
 type DataProvider func(ctx context.Context) (map[string][]byte, error)
 
+// Message is the data for a user together with the topic id it was created
+// for.
+type Message struct {
+	// ID contains the topic id of the data. It can be given to Resume() to
+	// continue a connection.
+	ID string
+
+	// Full is true, if Data contains all values and not only the values that
+	// changed since the last message.
+	Full bool
+
+	// Subscription is the name of the subscription on a multiplexed
+	// connection.
+	Subscription string
+
+	Data map[string][]byte
+
+	// ListDiff contains the changed list values, if the connection was created
+	// with listDiff. The keys in ListDiff are not in Data.
+	ListDiff map[string]ListDiff
+}
+
+// ListDiff describes the change of a list value since the last message.
+//
+// The new value is created by removing the elements in Remove from the old value
+// and appending the elements in Add.
+type ListDiff struct {
+	Add    []json.RawMessage
+	Remove []json.RawMessage
+}
+
+// empty returns true, if the message contains no values.
+func (m Message) empty() bool {
+	return len(m.Data) == 0 && len(m.ListDiff) == 0
+}
+
+// MessageProvider is like a DataProvider but returns the data as Message.
+type MessageProvider func(ctx context.Context) (Message, error)
+
 // Connect has to be called by a client to register to the service. The method
 // returns a Connection object, that can be used to receive the data.
 //
@@ -100,15 +155,36 @@ func (a *Autoupdate) Connect(userID int, kb KeysBuilder) DataProvider {
 	return c.Next
 }
 
+// Resume is like Connect, but continues a connection, that already received
+// the message with the topic id lastID.
+//
+// The first message only contains the values that changed since lastID. If this
+// is not possible, for example because lastID is to old, the first message
+// contains all values and Message.Full is true.
+//
+// If lastID is empty, a new connection is created like with Connect.
+//
+// If listDiff is true, changed lists of numbers or strings are returned in
+// Message.ListDiff instead of Message.Data, when the diff is shorter than the
+// value.
+func (a *Autoupdate) Resume(userID int, kb KeysBuilder, lastID string, listDiff bool) MessageProvider {
+	c := &connection{
+		autoupdate: a,
+		uid:        userID,
+		kb:         kb,
+		resumeID:   lastID,
+		filter:     filter{listDiff: listDiff},
+	}
+
+	return c.NextMessage
+}
+
 // SingleData returns the data for the kb. It is the same as calling Connect and
 // then Next for the first time.
 func (a *Autoupdate) SingleData(ctx context.Context, userID int, kb KeysBuilder, position int) (map[string][]byte, error) {
-	var getter datastore.Getter = a.datastore
-	var restricter datastore.Getter = a.restricter(getter, userID)
-
+	restricter := a.restricter(a.datastore, userID)
 	if position != 0 {
-		getter = datastore.NewGetPosition(a.datastore, position)
-		restricter = restrict.NewHistory(userID, a.datastore, getter)
+		restricter = a.positionRestricter(userID, position)
 	}
 
 	if err := kb.Update(ctx, restricter); err != nil {
@@ -123,9 +199,84 @@ func (a *Autoupdate) SingleData(ctx context.Context, userID int, kb KeysBuilder,
 	return data, nil
 }
 
-// LastID returns the id of the last data update.
-func (a *Autoupdate) LastID() uint64 {
-	return a.topic.LastID()
+// positionRestricter returns a getter for the restricted data at a position.
+func (a *Autoupdate) positionRestricter(userID int, position int) datastore.Getter {
+	getter := datastore.NewGetPosition(a.datastore, position)
+	if a.unrestricted {
+		return getter
+	}
+	return restrict.NewHistory(userID, a.datastore, getter)
+}
+
+// Change is the value of a key at two positions.
+type Change struct {
+	Old []byte
+	New []byte
+}
+
+// Changes returns the values of the keys, that are different at the positions
+// from and to.
+//
+// The keys are built at both positions. So keys, that were only requested at
+// one position are also returned. The data is restricted like with
+// SingleData() at a position.
+func (a *Autoupdate) Changes(ctx context.Context, userID int, kb KeysBuilder, from, to int) (map[string]Change, error) {
+	oldRestricter := a.positionRestricter(userID, from)
+	newRestricter := a.positionRestricter(userID, to)
+
+	if err := kb.Update(ctx, oldRestricter); err != nil {
+		return nil, fmt.Errorf("create keys for keysbuilder at position %d: %w", from, err)
+	}
+	oldKeys := append([]string(nil), kb.Keys()...)
+
+	if err := kb.Update(ctx, newRestricter); err != nil {
+		return nil, fmt.Errorf("create keys for keysbuilder at position %d: %w", to, err)
+	}
+	keys := append(oldKeys, notInSlice(kb.Keys(), oldKeys)...)
+
+	oldData, err := oldRestricter.Get(ctx, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("get restricted data at position %d: %w", from, err)
+	}
+
+	newData, err := newRestricter.Get(ctx, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("get restricted data at position %d: %w", to, err)
+	}
+
+	changes := make(map[string]Change)
+	for _, key := range keys {
+		if !bytes.Equal(oldData[key], newData[key]) {
+			changes[key] = Change{Old: oldData[key], New: newData[key]}
+		}
+	}
+
+	return changes, nil
+}
+
+// LastID returns the message id of the last data update.
+func (a *Autoupdate) LastID() string {
+	return a.messageID(a.topic.LastID())
+}
+
+// messageID returns the id of a message for the topic id tid.
+func (a *Autoupdate) messageID(tid uint64) string {
+	return fmt.Sprintf("%s-%d", a.epoch, tid)
+}
+
+// topicID returns the topic id from a message id. The second return value is
+// false, if the message id was not created by this instance.
+func (a *Autoupdate) topicID(messageID string) (uint64, bool) {
+	epoch, rawID, ok := strings.Cut(messageID, "-")
+	if !ok || epoch != a.epoch {
+		return 0, false
+	}
+
+	tid, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return tid, true
 }
 
 // PruneOldData removes old data from the topic. Blocks until the service is
@@ -144,10 +295,14 @@ func (a *Autoupdate) PruneOldData(ctx context.Context) {
 	}
 }
 
-// ResetCache runs in the background and cleans the cache from time to time.
+// ResetCache runs in the background and cleans the cache after each interval.
 // Blocks until the service is closed.
-func (a *Autoupdate) ResetCache(ctx context.Context) {
-	tick := time.NewTicker(datastoreCacheResetTime)
+//
+// When the datastore runs for a long time, its cache grows bigger and more
+// calculated keys have to be calculated. A reset means, that everything gets
+// cleaned. It is not necessary, if the cache has a max size.
+func (a *Autoupdate) ResetCache(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
 	defer tick.Stop()
 
 	for {
@@ -162,58 +317,6 @@ func (a *Autoupdate) ResetCache(ctx context.Context) {
 	}
 }
 
-// HistoryInformation writes the history information for an fqid.
-func (a *Autoupdate) HistoryInformation(ctx context.Context, uid int, fqid string, w io.Writer) error {
-	coll, rawID, found := strings.Cut(fqid, "/")
-	if !found {
-		return fmt.Errorf("invalid fqid")
-	}
-
-	id, err := strconv.Atoi(rawID)
-	if err != nil {
-		return fmt.Errorf("invalid fqid. ID part is not an int")
-	}
-
-	ds := datastore.NewRequest(a.datastore)
-
-	meetingID, hasMeeting, err := collection.Collection(coll).MeetingID(ctx, ds, id)
-	if err != nil {
-		var errNotExist datastore.DoesNotExistError
-		if errors.As(err, &errNotExist) {
-			return notExistError{string(errNotExist)}
-		}
-		return fmt.Errorf("getting meeting id for collection %s id %d: %w", coll, id, err)
-	}
-
-	if !hasMeeting {
-		hasOML, err := perm.HasOrganizationManagementLevel(ctx, ds, uid, perm.OMLCanManageOrganization)
-		if err != nil {
-			return fmt.Errorf("getting organization management level: %w", err)
-		}
-
-		if !hasOML {
-			return permissionDeniedError{fmt.Errorf("you are not allowed to use history information on %s", fqid)}
-		}
-	} else {
-		p, err := perm.New(ctx, ds, uid, meetingID)
-		if err != nil {
-			return fmt.Errorf("getting meeting permissions: %w", err)
-		}
-
-		if !p.Has(perm.MeetingCanSeeHistory) {
-			return permissionDeniedError{fmt.Errorf("you are not allowed to use history information on %s", fqid)}
-		}
-	}
-
-	if err := a.datastore.HistoryInformation(ctx, fqid, w); err != nil {
-		return fmt.Errorf("getting history information: %w", err)
-	}
-
-	fmt.Fprintln(w)
-
-	return nil
-}
-
 type permissionDeniedError struct {
 	err error
 }
@@ -226,6 +329,18 @@ func (e permissionDeniedError) Type() string {
 	return "permission_denied"
 }
 
+type invalidRequestError struct {
+	msg string
+}
+
+func (e invalidRequestError) Error() string {
+	return e.msg
+}
+
+func (e invalidRequestError) Type() string {
+	return "invalid_request"
+}
+
 type notExistError struct {
 	fqid string
 }
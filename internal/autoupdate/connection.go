@@ -2,9 +2,12 @@ package autoupdate
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+	"github.com/ostcar/topic"
 )
 
 // connection holds the state of a client. It has to be created by colling
@@ -16,6 +19,10 @@ type connection struct {
 	tid        uint64
 	filter     filter
 	hotkeys    map[string]bool
+
+	// resumeID is the message id of the last message, the client received on
+	// an earlier connection.
+	resumeID string
 }
 
 // Next returns the next data for the user.
@@ -25,41 +32,227 @@ type connection struct {
 //
 // On every other call, it blocks until there is new data. In this case, the map
 // is never empty.
+//
+// If the keysbuilder was changed since the last call, Next does not block but
+// returns the data for the added keys. If no new data is necessary, it blocks
+// like normal.
 func (c *connection) Next(ctx context.Context) (map[string][]byte, error) {
+	msg, err := c.NextMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+// NextMessage is like Next, but also returns the topic id of the data.
+func (c *connection) NextMessage(ctx context.Context) (Message, error) {
 	if c.filter.empty() {
-		data, err := c.data(ctx)
+		if c.resumeID != "" {
+			msg, err := c.resume(ctx, c.resumeID)
+			if err != nil {
+				return Message{}, fmt.Errorf("resuming connection: %w", err)
+			}
+
+			return msg, nil
+		}
+
+		msg, err := c.data(ctx)
+		if err != nil {
+			return Message{}, fmt.Errorf("creating first time data: %w", err)
+		}
+
+		msg.Full = true
+		return msg, nil
+	}
+
+	if changer, ok := c.kb.(keysChanger); ok && changer.Changed() {
+		msg, err := c.data(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("creating first time data: %w", err)
+			return Message{}, fmt.Errorf("creating data for changed keys: %w", err)
 		}
 
-		return data, nil
+		if !msg.empty() {
+			return msg, nil
+		}
 	}
 
 	for {
 		// Blocks until the topic is closed (on server exit) or the context is done.
 		tid, changedKeys, err := c.autoupdate.topic.Receive(ctx, c.tid)
 		if err != nil {
-			return nil, fmt.Errorf("get updated keys: %w", err)
+			return Message{}, fmt.Errorf("get updated keys: %w", err)
 		}
+
+		if !c.relevant(changedKeys) {
+			c.tid = tid
+			continue
+		}
+
+		lastTID := c.tid
 		c.tid = tid
+		msg, err := c.data(ctx)
+		if err != nil {
+			// The data for tid was not created, for example because the
+			// context was canceled by a control message. Receive the same
+			// keys again on the next call.
+			c.tid = lastTID
+			return Message{}, fmt.Errorf("creating later data: %w", err)
+		}
+
+		if !msg.empty() {
+			return msg, nil
+		}
+	}
+}
+
+// relevant returns true, if one of the changed keys changes the data of the
+// connection.
+func (c *connection) relevant(changedKeys []string) bool {
+	for _, key := range changedKeys {
+		if c.hotkeys[key] || isFullUpdate(key, c.uid) {
+			return true
+		}
+	}
+	return false
+}
+
+// resume creates the first message for a client, that already received all
+// data until the message id lastID.
+//
+// Only the requested keys that changed since lastID are returned. If a key
+// changed, that was used to build the keys or to restrict the values, all data
+// is returned as a full message. The same happens, if lastID is not in the
+// topic anymore or if it was created by another instance.
+func (c *connection) resume(ctx context.Context, lastID string) (Message, error) {
+	tid, changed, full, err := c.changedSince(ctx, lastID)
+	if err != nil {
+		return Message{}, fmt.Errorf("getting changed keys since %s: %w", lastID, err)
+	}
+	c.tid = tid
+
+	recorder := datastore.NewRecorder(c.autoupdate.datastore)
+	restricter := c.autoupdate.restricter(recorder, c.uid)
+	kbRecorder := datastore.NewRecorder(restricter)
+
+	if err := c.kb.Update(ctx, kbRecorder); err != nil {
+		return Message{}, fmt.Errorf("create keys for keysbuilder: %w", err)
+	}
+
+	keys := c.kb.Keys()
+	data, err := restricter.Get(ctx, keys...)
+	if err != nil {
+		return Message{}, fmt.Errorf("get restricted data: %w", err)
+	}
+	c.hotkeys = recorder.Keys()
+
+	requested := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		requested[key] = true
+	}
 
-		for _, key := range changedKeys {
-			if c.hotkeys[key] {
-				data, err := c.data(ctx)
-				if err != nil {
-					return nil, fmt.Errorf("creating later data: %w", err)
-				}
-				if len(data) > 0 {
-					return data, nil
-				}
-				break
+	changedRequested := false
+	for key := range changed {
+		if kbRecorder.Keys()[key] || (c.hotkeys[key] && !requested[key]) {
+			full = true
+			break
+		}
+
+		if requested[key] {
+			changedRequested = true
+		}
+	}
+
+	if !full && changedRequested {
+		full, err = c.usedForRestriction(ctx, keys, changed)
+		if err != nil {
+			return Message{}, fmt.Errorf("checking changed keys for restriction: %w", err)
+		}
+	}
+
+	var changedData map[string][]byte
+	if !full {
+		changedData = make(map[string][]byte)
+		for _, key := range keys {
+			if changed[key] {
+				changedData[key] = data[key]
 			}
 		}
 	}
+
+	c.filter.filter(data)
+
+	if full {
+		return Message{ID: c.autoupdate.messageID(c.tid), Full: true, Data: data}, nil
+	}
+	return Message{ID: c.autoupdate.messageID(c.tid), Data: changedData}, nil
 }
 
-// data returns all values from the datastore.getter.
-func (c *connection) data(ctx context.Context) (map[string][]byte, error) {
+// usedForRestriction returns true, if one of the changed keys is used to
+// restrict the other requested keys.
+//
+// A requested key is also read as value, so the recorder of the restricter can
+// not tell, why a key was read. Therefore the keys, that did not change, are
+// restricted again. If one of the changed keys is read, it is used for the
+// restriction.
+func (c *connection) usedForRestriction(ctx context.Context, keys []string, changed map[string]bool) (bool, error) {
+	unchanged := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !changed[key] {
+			unchanged = append(unchanged, key)
+		}
+	}
+
+	recorder := datastore.NewRecorder(c.autoupdate.datastore)
+	if _, err := c.autoupdate.restricter(recorder, c.uid).Get(ctx, unchanged...); err != nil {
+		return false, fmt.Errorf("restrict unchanged keys: %w", err)
+	}
+
+	for key := range recorder.Keys() {
+		if changed[key] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// changedSince returns the current topic id and all keys that changed since
+// lastID.
+//
+// If the changed keys can not be calculated, full is true.
+func (c *connection) changedSince(ctx context.Context, lastID string) (tid uint64, changed map[string]bool, full bool, err error) {
+	currentID := c.autoupdate.topic.LastID()
+	lastTID, ok := c.autoupdate.topicID(lastID)
+	if !ok || lastTID > currentID {
+		// The id is from another instance or from before a restart.
+		return currentID, nil, true, nil
+	}
+
+	if lastTID == currentID {
+		return currentID, nil, false, nil
+	}
+
+	tid, keys, err := c.autoupdate.topic.Receive(ctx, lastTID)
+	if err != nil {
+		var errUnknownID topic.UnknownIDError
+		if errors.As(err, &errUnknownID) {
+			return currentID, nil, true, nil
+		}
+		return 0, nil, false, fmt.Errorf("receive changed keys: %w", err)
+	}
+
+	changed = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if isFullUpdate(key, c.uid) {
+			return tid, nil, true, nil
+		}
+		changed[key] = true
+	}
+	return tid, changed, false, nil
+}
+
+// data returns all values from the datastore.getter that changed since the last
+// call.
+func (c *connection) data(ctx context.Context) (Message, error) {
 	if c.tid == 0 {
 		c.tid = c.autoupdate.topic.LastID()
 	}
@@ -70,7 +263,7 @@ func (c *connection) data(ctx context.Context) (map[string][]byte, error) {
 	restricter := c.autoupdate.restricter(recorder, c.uid)
 
 	if err := c.kb.Update(ctx, restricter); err != nil {
-		return nil, fmt.Errorf("create keys for keysbuilder: %w", err)
+		return Message{}, fmt.Errorf("create keys for keysbuilder: %w", err)
 	}
 
 	newKeys := c.kb.Keys()
@@ -81,13 +274,27 @@ func (c *connection) data(ctx context.Context) (map[string][]byte, error) {
 
 	data, err := restricter.Get(ctx, newKeys...)
 	if err != nil {
-		return nil, fmt.Errorf("get restricted data: %w", err)
+		return Message{}, fmt.Errorf("get restricted data: %w", err)
 	}
 	c.hotkeys = recorder.Keys()
 
-	c.filter.filter(data)
+	diff := c.filter.filter(data)
 
-	return data, nil
+	return Message{ID: c.autoupdate.messageID(c.tid), Data: data, ListDiff: diff}, nil
+}
+
+// isFullUpdate returns true, if the topic key means, that all data of the user
+// has to be recalculated.
+func isFullUpdate(key string, uid int) bool {
+	if !strings.HasPrefix(key, "fullupdate/") {
+		return false
+	}
+
+	var keyUID int
+	if _, err := fmt.Sscanf(key, fullUpdateFormat, &keyUID); err != nil {
+		return false
+	}
+	return keyUID == -1 || keyUID == uid
 }
 
 // notInSlice returns elements that are in slice a but not in b.
@@ -6,10 +6,12 @@ import (
 	"log"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/keysbuilder"
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/dsmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -446,3 +448,403 @@ func TestKeyRequestedAgain(t *testing.T) {
 		t.Errorf("Got organization_tag/2/id: %q, expected 2", v)
 	}
 }
+
+func TestKeysChanged(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+	user/1/name: Hello
+	user/2/name: World
+	`))
+
+	s := autoupdate.New(datastore, test.RestrictAllowed, "")
+	kb, err := keysbuilder.FromKeys([]string{"user/1/name"})
+	if err != nil {
+		t.Fatalf("Can not build request: %v", err)
+	}
+
+	next := s.Connect(1, kb)
+	if _, err := next(shutdownCtx); err != nil {
+		t.Fatalf("Getting first data: %v", err)
+	}
+
+	added, err := keysbuilder.FromKeys([]string{"user/2/name"})
+	if err != nil {
+		t.Fatalf("Can not build added request: %v", err)
+	}
+	kb.Add(added)
+
+	var data map[string][]byte
+	if blocking(func() { data, err = next(shutdownCtx) }) {
+		t.Fatalf("next() blocked after keys where added")
+	}
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user/2/name": []byte(`"World"`)}, data, "next() should only return the added key")
+
+	removed, err := keysbuilder.FromKeys([]string{"user/1/name"})
+	if err != nil {
+		t.Fatalf("Can not build removed request: %v", err)
+	}
+	kb.Remove(removed)
+
+	ctx, cancelNext := context.WithCancel(shutdownCtx)
+	done := make(chan struct{})
+	isBlocking := blocking(func() {
+		defer close(done)
+		next(ctx)
+	})
+	cancelNext()
+	<-done
+
+	if !isBlocking {
+		t.Errorf("next() did not block after a key was removed")
+	}
+
+	kb.Add(removed)
+
+	if blocking(func() { data, err = next(shutdownCtx) }) {
+		t.Fatalf("next() blocked after keys where added again")
+	}
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user/1/name": []byte(`"Hello"`)}, data, "next() should return the key that was added again")
+}
+
+func TestResume(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+	user/1/name: Hello
+	user/2/name: World
+	`))
+	go datastore.ListenOnUpdates(shutdownCtx, nil)
+
+	s := autoupdate.New(datastore, test.RestrictAllowed, "")
+	kb := test.KeysBuilder{K: test.Str("user/1/name", "user/2/name")}
+
+	first, err := s.Resume(1, kb, "", false)(shutdownCtx)
+	require.NoError(t, err)
+	assert.True(t, first.Full, "first message of a new connection should be full")
+
+	// Wait until the update is processed.
+	next := s.Connect(1, kb)
+	if _, err := next(shutdownCtx); err != nil {
+		t.Fatalf("Getting first data: %v", err)
+	}
+	datastore.Send(map[string][]byte{"user/1/name": []byte(`"Hubert"`)})
+	if _, err := next(shutdownCtx); err != nil {
+		t.Fatalf("Getting second data: %v", err)
+	}
+
+	t.Run("known id", func(t *testing.T) {
+		msg, err := s.Resume(1, kb, first.ID, false)(shutdownCtx)
+		require.NoError(t, err)
+
+		assert.False(t, msg.Full)
+		assert.Equal(t, s.LastID(), msg.ID)
+		assert.Equal(t, map[string][]byte{"user/1/name": []byte(`"Hubert"`)}, msg.Data)
+	})
+
+	t.Run("current id", func(t *testing.T) {
+		msg, err := s.Resume(1, kb, s.LastID(), false)(shutdownCtx)
+		require.NoError(t, err)
+
+		assert.False(t, msg.Full)
+		assert.Empty(t, msg.Data)
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		epoch, _, _ := strings.Cut(s.LastID(), "-")
+		msg, err := s.Resume(1, kb, epoch+"-1000", false)(shutdownCtx)
+		require.NoError(t, err)
+
+		assert.True(t, msg.Full)
+		assert.Equal(t, map[string][]byte{
+			"user/1/name": []byte(`"Hubert"`),
+			"user/2/name": []byte(`"World"`),
+		}, msg.Data)
+	})
+
+	t.Run("id from other instance", func(t *testing.T) {
+		// The other instance has the same topic ids, but they do not describe
+		// the same updates.
+		other := autoupdate.New(datastore, test.RestrictAllowed, "")
+
+		msg, err := s.Resume(1, kb, other.LastID(), false)(shutdownCtx)
+		require.NoError(t, err)
+
+		assert.True(t, msg.Full)
+		assert.Equal(t, map[string][]byte{
+			"user/1/name": []byte(`"Hubert"`),
+			"user/2/name": []byte(`"World"`),
+		}, msg.Data)
+	})
+}
+
+// visibleRestricter only returns user/1/name, if user/1/visible is true.
+func visibleRestricter(getter datastore.Getter, uid int) datastore.Getter {
+	return visibleGetter{getter}
+}
+
+type visibleGetter struct {
+	getter datastore.Getter
+}
+
+func (g visibleGetter) Get(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	data, err := g.getter.Get(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := data["user/1/name"]; ok {
+		visible, err := g.getter.Get(ctx, "user/1/visible")
+		if err != nil {
+			return nil, err
+		}
+
+		if string(visible["user/1/visible"]) != "true" {
+			data["user/1/name"] = nil
+		}
+	}
+	return data, nil
+}
+
+func TestResumeChangedRestrictionKey(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+	user/1/name: Hello
+	user/1/visible: true
+	`))
+	go datastore.ListenOnUpdates(shutdownCtx, nil)
+
+	s := autoupdate.New(datastore, visibleRestricter, "")
+	kb := test.KeysBuilder{K: test.Str("user/1/name", "user/1/visible")}
+
+	first, err := s.Resume(1, kb, "", false)(shutdownCtx)
+	require.NoError(t, err)
+
+	// Wait until the update is processed.
+	next := s.Connect(1, kb)
+	if _, err := next(shutdownCtx); err != nil {
+		t.Fatalf("Getting first data: %v", err)
+	}
+	datastore.Send(map[string][]byte{"user/1/visible": []byte(`false`)})
+	if _, err := next(shutdownCtx); err != nil {
+		t.Fatalf("Getting second data: %v", err)
+	}
+
+	msg, err := s.Resume(1, kb, first.ID, false)(shutdownCtx)
+	require.NoError(t, err)
+
+	assert.True(t, msg.Full, "a changed key, that is used for the restriction, has to create a full message")
+	assert.Equal(t, map[string][]byte{"user/1/visible": []byte(`false`)}, msg.Data)
+}
+
+func TestUnrestricted(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+	user/1/name: Hello
+	`))
+
+	s := autoupdate.New(datastore, test.RestrictNotAllowed, "")
+	kb := test.KeysBuilder{K: test.Str("user/1/name")}
+
+	restricted, err := s.SingleData(shutdownCtx, 1, kb, 0)
+	require.NoError(t, err)
+	assert.Empty(t, restricted["user/1/name"])
+
+	unrestricted, err := s.Unrestricted().SingleData(shutdownCtx, 1, kb, 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user/1/name": []byte(`"Hello"`)}, unrestricted)
+}
+
+// positionDatastore is a datastore that returns the data from a map for each
+// position.
+type positionDatastore struct {
+	*dsmock.MockDatastore
+	positions map[int]map[string][]byte
+}
+
+func (ds positionDatastore) GetPosition(ctx context.Context, position int, keys ...string) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		data[key] = ds.positions[position][key]
+	}
+	return data, nil
+}
+
+func TestChanges(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := positionDatastore{
+		MockDatastore: dsmock.NewMockDatastore(shutdownCtx.Done(), nil),
+		positions: map[int]map[string][]byte{
+			1: dsmock.YAMLData(`---
+			user/1/name: old
+			user/1/username: same
+			user/1/first_name: deleted
+			`),
+			2: dsmock.YAMLData(`---
+			user/1/name: new
+			user/1/username: same
+			user/1/last_name: created
+			`),
+		},
+	}
+
+	s := autoupdate.New(datastore, test.RestrictNotAllowed, "").Unrestricted()
+	kb := test.KeysBuilder{K: test.Str("user/1/name", "user/1/username", "user/1/first_name", "user/1/last_name")}
+
+	changes, err := s.Changes(shutdownCtx, 1, kb, 1, 2)
+	require.NoError(t, err)
+
+	expect := map[string]autoupdate.Change{
+		"user/1/name":       {Old: []byte(`"old"`), New: []byte(`"new"`)},
+		"user/1/first_name": {Old: []byte(`"deleted"`)},
+		"user/1/last_name":  {New: []byte(`"created"`)},
+	}
+	assert.Equal(t, expect, changes)
+}
+
+func TestChangesRestricted(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	positions := map[int]map[string][]byte{
+		1: dsmock.YAMLData(`---
+		motion/1/meeting_id: 1
+		motion/1/title: old
+		`),
+		2: dsmock.YAMLData(`---
+		motion/1/meeting_id: 1
+		motion/1/title: new
+		`),
+	}
+
+	for _, tt := range []struct {
+		name   string
+		data   string
+		expect map[string]autoupdate.Change
+	}{
+		{
+			"meeting admin",
+			`---
+			user/1/meeting_ids: [1]
+			user/1/group_$1_ids: [1]
+			group/1/meeting_id: 1
+			meeting/1/admin_group_id: 1
+			`,
+			map[string]autoupdate.Change{
+				"motion/1/title": {Old: []byte(`"old"`), New: []byte(`"new"`)},
+			},
+		},
+		{
+			"can see history without admin",
+			`---
+			user/1/meeting_ids: [1]
+			user/1/group_$1_ids: [1]
+			group/1/meeting_id: 1
+			group/1/permissions: [meeting.can_see_history]
+			meeting/1/admin_group_id: 2
+			`,
+			map[string]autoupdate.Change{},
+		},
+		{
+			"not in meeting",
+			`---
+			user/1/username: hugo
+			meeting/1/admin_group_id: 2
+			`,
+			map[string]autoupdate.Change{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			datastore := positionDatastore{
+				MockDatastore: dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(tt.data)),
+				positions:     positions,
+			}
+
+			s := autoupdate.New(datastore, test.RestrictAllowed, "")
+			kb := test.KeysBuilder{K: test.Str("motion/1/title")}
+
+			changes, err := s.Changes(shutdownCtx, 1, kb, 1, 2)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expect, changes)
+		})
+	}
+}
+
+// fullUpdateDatastore is a datastore that remembers the full update listener.
+type fullUpdateDatastore struct {
+	*dsmock.MockDatastore
+	fullUpdate func()
+}
+
+func (ds *fullUpdateDatastore) RegisterFullUpdateListener(f func()) {
+	ds.fullUpdate = f
+}
+
+func TestConnectionFullUpdate(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := map[string][]byte{"user/1/name": []byte(`"Hello"`)}
+	datastore := &fullUpdateDatastore{MockDatastore: dsmock.NewMockDatastore(shutdownCtx.Done(), data)}
+
+	s := autoupdate.New(datastore, test.RestrictAllowed, "")
+	kb := test.KeysBuilder{K: test.Str("user/1/name")}
+	next := s.Connect(1, kb)
+
+	if _, err := next(shutdownCtx); err != nil {
+		t.Fatalf("next() returned an unexpected error: %v", err)
+	}
+
+	// Change the value without an update. This happens, when the datastore
+	// missed an update.
+	data["user/1/name"] = []byte(`"World"`)
+	datastore.ResetCache()
+	datastore.fullUpdate()
+
+	got, err := next(shutdownCtx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user/1/name": []byte(`"World"`)}, got)
+}
+
+func TestConnectionRetryAfterFailedData(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next, datastore := getConnection(shutdownCtx.Done())
+	go datastore.ListenOnUpdates(shutdownCtx, func(err error) { log.Println(err) })
+
+	if _, err := next(context.Background()); err != nil {
+		t.Fatalf("next() returned an error: %v", err)
+	}
+
+	// Creating the data fails, like when the context of a connection is
+	// canceled while the data is created.
+	datastore.InjectError(errors.New("my error"))
+	datastore.Send(map[string][]byte{"user/1/name": []byte(`"new value"`)})
+	if _, err := next(context.Background()); err == nil {
+		t.Fatalf("next() did not return the injected error")
+	}
+	datastore.InjectError(nil)
+
+	ctx, cancelNext := context.WithTimeout(context.Background(), time.Second)
+	defer cancelNext()
+	data, err := next(ctx)
+	if err != nil {
+		t.Fatalf("next() returned an error: %v", err)
+	}
+
+	if value := data["user/1/name"]; string(value) != `"new value"` {
+		t.Errorf("next() returned %v, expected the new value", data)
+	}
+}
@@ -1,6 +1,8 @@
 package autoupdate
 
 import (
+	"bytes"
+	"encoding/json"
 	"hash/maphash"
 )
 
@@ -15,16 +17,28 @@ func createHash(hasher *maphash.Hash, value []byte) uint64 {
 type filter struct {
 	hasher  maphash.Hash
 	history map[string]uint64
+
+	// If listDiff is true, the filter keeps the last values and changed list
+	// values are returned as ListDiff.
+	listDiff bool
+	values   map[string][]byte
 }
 
 // filter has to be called on a reader that contains a decoded json object. It
 // removes nil values from a map. Filter is called multiple times it removes
 // values from the map, that did not chance.
-func (f *filter) filter(data map[string][]byte) {
+//
+// If the filter was created with listDiff, changed list values are removed
+// from the map and returned as ListDiff, when this is shorter.
+func (f *filter) filter(data map[string][]byte) map[string]ListDiff {
 	if f.history == nil {
 		f.history = make(map[string]uint64)
+		if f.listDiff {
+			f.values = make(map[string][]byte)
+		}
 	}
 
+	var diffs map[string]ListDiff
 	for key, value := range data {
 		if len(value) == 0 {
 			// Value does not exist or user has no permission to see it.
@@ -33,6 +47,7 @@ func (f *filter) filter(data map[string][]byte) {
 				delete(data, key)
 			}
 			f.history[key] = 0
+			delete(f.values, key)
 			continue
 		}
 
@@ -42,7 +57,26 @@ func (f *filter) filter(data map[string][]byte) {
 			continue
 		}
 		f.history[key] = newHash
+
+		if !f.listDiff {
+			continue
+		}
+
+		oldValue := f.values[key]
+		f.values[key] = value
+		if oldValue == nil {
+			continue
+		}
+
+		if diff, ok := listDiff(oldValue, value); ok {
+			if diffs == nil {
+				diffs = make(map[string]ListDiff)
+			}
+			diffs[key] = diff
+			delete(data, key)
+		}
 	}
+	return diffs
 }
 
 // empty returns true, if the filter was not called before.
@@ -55,4 +89,86 @@ func (f *filter) empty() bool {
 // The next time the filter is called with the key, it will not be filtered.
 func (f *filter) delete(k string) {
 	delete(f.history, k)
+	delete(f.values, k)
+}
+
+// listDiff returns the operations to change the json list oldValue to
+// newValue.
+//
+// The second return value is false, if the values are not lists of unique
+// numbers or strings, if the operations would not create newValue in the same
+// order or if the operations are not shorter then the new list.
+func listDiff(oldValue, newValue []byte) (ListDiff, bool) {
+	oldList, ok := uniqueScalarList(oldValue)
+	if !ok {
+		return ListDiff{}, false
+	}
+
+	newList, ok := uniqueScalarList(newValue)
+	if !ok {
+		return ListDiff{}, false
+	}
+
+	inOld := make(map[string]bool, len(oldList))
+	for _, v := range oldList {
+		inOld[string(v)] = true
+	}
+
+	inNew := make(map[string]bool, len(newList))
+	for _, v := range newList {
+		inNew[string(v)] = true
+	}
+
+	var diff ListDiff
+	var expected []json.RawMessage
+	for _, v := range oldList {
+		if !inNew[string(v)] {
+			diff.Remove = append(diff.Remove, v)
+			continue
+		}
+		expected = append(expected, v)
+	}
+
+	for _, v := range newList {
+		if !inOld[string(v)] {
+			diff.Add = append(diff.Add, v)
+			expected = append(expected, v)
+		}
+	}
+
+	if len(diff.Add)+len(diff.Remove) >= len(newList) {
+		return ListDiff{}, false
+	}
+
+	// The client appends the new values. If the new list has another order, the
+	// whole value has to be sent.
+	for i := range expected {
+		if !bytes.Equal(expected[i], newList[i]) {
+			return ListDiff{}, false
+		}
+	}
+
+	return diff, true
+}
+
+// uniqueScalarList decodes a json list. It returns false, if the value is not a
+// list, if it contains objects or lists or if an element is not unique.
+func uniqueScalarList(value []byte) ([]json.RawMessage, bool) {
+	if len(value) == 0 || value[0] != '[' {
+		return nil, false
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(value, &list); err != nil {
+		return nil, false
+	}
+
+	seen := make(map[string]bool, len(list))
+	for _, v := range list {
+		if len(v) == 0 || v[0] == '{' || v[0] == '[' || seen[string(v)] {
+			return nil, false
+		}
+		seen[string(v)] = true
+	}
+	return list, true
 }
@@ -1,6 +1,7 @@
 package autoupdate
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -165,3 +166,86 @@ func TestFilterChangeTwice(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterListDiff(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		origian    string
+		new        string
+		expectData map[string][]byte
+		expectDiff map[string]ListDiff
+	}{
+		{
+			"Add one id",
+			`[1,2,3,4]`,
+			`[1,2,3,4,5]`,
+			map[string][]byte{},
+			map[string]ListDiff{"k1": {Add: []json.RawMessage{[]byte("5")}}},
+		},
+		{
+			"Remove one id",
+			`[1,2,3,4]`,
+			`[1,3,4]`,
+			map[string][]byte{},
+			map[string]ListDiff{"k1": {Remove: []json.RawMessage{[]byte("2")}}},
+		},
+		{
+			"Add and remove strings",
+			`["motion/1","motion/2","motion/3","motion/4"]`,
+			`["motion/1","motion/3","motion/4","motion/5"]`,
+			map[string][]byte{},
+			map[string]ListDiff{"k1": {Add: []json.RawMessage{[]byte(`"motion/5"`)}, Remove: []json.RawMessage{[]byte(`"motion/2"`)}}},
+		},
+		{
+			"Diff is not shorter",
+			`[1,2]`,
+			`[3]`,
+			map[string][]byte{"k1": []byte(`[3]`)},
+			nil,
+		},
+		{
+			"Order changed",
+			`[1,2,3,4]`,
+			`[5,1,2,3,4]`,
+			map[string][]byte{"k1": []byte(`[5,1,2,3,4]`)},
+			nil,
+		},
+		{
+			"No list",
+			`"foo"`,
+			`"bar"`,
+			map[string][]byte{"k1": []byte(`"bar"`)},
+			nil,
+		},
+		{
+			"List of objects",
+			`[{"a":1},{"b":2},{"c":3}]`,
+			`[{"a":1},{"b":2},{"c":3},{"d":4}]`,
+			map[string][]byte{"k1": []byte(`[{"a":1},{"b":2},{"c":3},{"d":4}]`)},
+			nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filter{listDiff: true}
+			f.filter(map[string][]byte{"k1": []byte(tt.origian)})
+
+			data := map[string][]byte{"k1": []byte(tt.new)}
+			diff := f.filter(data)
+
+			assert.Equal(t, tt.expectData, data)
+			assert.Equal(t, tt.expectDiff, diff)
+		})
+	}
+}
+
+func TestFilterListDiffAfterDelete(t *testing.T) {
+	f := filter{listDiff: true}
+	f.filter(map[string][]byte{"k1": []byte(`[1,2,3]`)})
+	f.delete("k1")
+
+	data := map[string][]byte{"k1": []byte(`[1,2,3,4]`)}
+	diff := f.filter(data)
+
+	assert.Equal(t, map[string][]byte{"k1": []byte(`[1,2,3,4]`)}, data)
+	assert.Nil(t, diff)
+}
@@ -0,0 +1,318 @@
+package autoupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/restrict/collection"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/restrict/perm"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+)
+
+// fieldHistoryWorkers is the maximal number of positions, that are read at the
+// same time by FieldHistory().
+const fieldHistoryWorkers = 10
+
+// HistoryQuery selects the history entries, that are returned by
+// HistoryInformation().
+type HistoryQuery struct {
+	// FQIDs are the objects to get the history for.
+	FQIDs []string
+
+	// UserID only selects the entries of this user. 0 selects all users.
+	UserID int
+
+	// Since and Until only select entries with a timestamp in this range. Both
+	// values are inclusive. 0 means, that the range is open on this side.
+	Since int
+	Until int
+
+	// Offset skips the first entries. Limit is the maximal number of returned
+	// entries. 0 means no limit.
+	Offset int
+	Limit  int
+}
+
+// HistoryEntry is one entry in the history of an object.
+type HistoryEntry struct {
+	FQID        string          `json:"fqid"`
+	Position    int             `json:"position"`
+	Timestamp   int             `json:"timestamp"`
+	UserID      int             `json:"user_id"`
+	Information json.RawMessage `json:"information"`
+}
+
+// HistoryPage is the result of a history query.
+//
+// Total is the number of entries, that match the query without offset and
+// limit.
+type HistoryPage struct {
+	Total   int            `json:"total"`
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// HistoryInformation returns the history information for the fqids of the
+// query.
+//
+// The entries of all fqids are sorted by position. Entries with the same
+// position are sorted in the order of the fqids in the query.
+func (a *Autoupdate) HistoryInformation(ctx context.Context, uid int, query HistoryQuery) (HistoryPage, error) {
+	fqids := uniqueStrings(query.FQIDs)
+
+	ds := datastore.NewRequest(a.datastore)
+	for _, fqid := range fqids {
+		if err := canSeeHistory(ctx, ds, uid, fqid); err != nil {
+			return HistoryPage{}, err
+		}
+	}
+
+	history, err := a.datastore.HistoryInformation(ctx, fqids...)
+	if err != nil {
+		return HistoryPage{}, fmt.Errorf("getting history information: %w", err)
+	}
+
+	entries := []HistoryEntry{}
+	for _, fqid := range fqids {
+		for _, info := range history[fqid] {
+			if !query.matches(info) {
+				continue
+			}
+
+			entries = append(entries, HistoryEntry{
+				FQID:        fqid,
+				Position:    info.Position,
+				Timestamp:   info.Timestamp,
+				UserID:      info.UserID,
+				Information: info.Information,
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Position < entries[j].Position
+	})
+
+	return HistoryPage{
+		Total:   len(entries),
+		Entries: query.page(entries),
+	}, nil
+}
+
+// FieldChange is the value of a field after it was changed at a position.
+//
+// Value is nil, if the field was deleted or the user is not allowed to see it
+// at this position.
+type FieldChange struct {
+	Position  int             `json:"position"`
+	Timestamp int             `json:"timestamp"`
+	UserID    int             `json:"user_id"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// FieldHistory returns all values of a fqfield.
+//
+// It reads the value at each history position of the object and only returns
+// the positions, where the value changed. The values are restricted like with
+// SingleData() at a position.
+func (a *Autoupdate) FieldHistory(ctx context.Context, uid int, fqfield string) ([]FieldChange, error) {
+	parts := strings.Split(fqfield, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, invalidRequestError{fmt.Sprintf("invalid fqfield %s", fqfield)}
+	}
+
+	if _, err := strconv.Atoi(parts[1]); err != nil {
+		return nil, invalidRequestError{fmt.Sprintf("invalid fqfield %s. ID part is not an int", fqfield)}
+	}
+	fqid := parts[0] + "/" + parts[1]
+
+	if err := canSeeHistory(ctx, datastore.NewRequest(a.datastore), uid, fqid); err != nil {
+		return nil, err
+	}
+
+	history, err := a.datastore.HistoryInformation(ctx, fqid)
+	if err != nil {
+		return nil, fmt.Errorf("getting history information: %w", err)
+	}
+
+	entries := history[fqid]
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Position < entries[j].Position
+	})
+
+	values, err := a.valuesAtPositions(ctx, uid, fqfield, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	var last []byte
+	for i, entry := range entries {
+		value := values[i]
+		if bytes.Equal(value, last) {
+			continue
+		}
+		last = value
+
+		changes = append(changes, FieldChange{
+			Position:  entry.Position,
+			Timestamp: entry.Timestamp,
+			UserID:    entry.UserID,
+			Value:     value,
+		})
+	}
+
+	return changes, nil
+}
+
+// valuesAtPositions returns the restricted value of the fqfield at the position
+// of each history entry.
+//
+// The positions are read concurrently, but at most fieldHistoryWorkers at the
+// same time.
+func (a *Autoupdate) valuesAtPositions(ctx context.Context, uid int, fqfield string, entries []datastore.HistoryInformation) ([][]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	values := make([][]byte, len(entries))
+
+	var mu sync.Mutex
+	var firstErr error
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, fieldHistoryWorkers)
+	for i, entry := range entries {
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, position int) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			data, err := a.positionRestricter(uid, position).Get(ctx, fqfield)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("getting %s at position %d: %w", fqfield, position, err)
+				}
+				mu.Unlock()
+				cancel()
+				return
+			}
+
+			values[i] = data[fqfield]
+		}(i, entry.Position)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("getting %s: %w", fqfield, err)
+	}
+	return values, nil
+}
+
+// matches returns true, if the history entry matches the filters of the query.
+func (q HistoryQuery) matches(info datastore.HistoryInformation) bool {
+	if q.UserID != 0 && info.UserID != q.UserID {
+		return false
+	}
+
+	if q.Since != 0 && info.Timestamp < q.Since {
+		return false
+	}
+
+	if q.Until != 0 && info.Timestamp > q.Until {
+		return false
+	}
+
+	return true
+}
+
+// page returns the part of the entries, that is selected by offset and limit.
+func (q HistoryQuery) page(entries []HistoryEntry) []HistoryEntry {
+	if q.Offset >= len(entries) {
+		return []HistoryEntry{}
+	}
+	entries = entries[q.Offset:]
+
+	if q.Limit != 0 && q.Limit < len(entries) {
+		entries = entries[:q.Limit]
+	}
+	return entries
+}
+
+// canSeeHistory returns an error, if the user is not allowed to see the
+// history of the fqid.
+func canSeeHistory(ctx context.Context, ds *datastore.Request, uid int, fqid string) error {
+	coll, rawID, found := strings.Cut(fqid, "/")
+	if !found {
+		return invalidRequestError{fmt.Sprintf("invalid fqid %s", fqid)}
+	}
+
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return invalidRequestError{fmt.Sprintf("invalid fqid %s. ID part is not an int", fqid)}
+	}
+
+	meetingID, hasMeeting, err := collection.Collection(coll).MeetingID(ctx, ds, id)
+	if err != nil {
+		var errNotExist datastore.DoesNotExistError
+		if errors.As(err, &errNotExist) {
+			return notExistError{string(errNotExist)}
+		}
+		return fmt.Errorf("getting meeting id for collection %s id %d: %w", coll, id, err)
+	}
+
+	if !hasMeeting {
+		hasOML, err := perm.HasOrganizationManagementLevel(ctx, ds, uid, perm.OMLCanManageOrganization)
+		if err != nil {
+			return fmt.Errorf("getting organization management level: %w", err)
+		}
+
+		if !hasOML {
+			return permissionDeniedError{fmt.Errorf("you are not allowed to use history information on %s", fqid)}
+		}
+		return nil
+	}
+
+	p, err := perm.New(ctx, ds, uid, meetingID)
+	if err != nil {
+		return fmt.Errorf("getting meeting permissions: %w", err)
+	}
+
+	if !p.Has(perm.MeetingCanSeeHistory) {
+		return permissionDeniedError{fmt.Errorf("you are not allowed to use history information on %s", fqid)}
+	}
+	return nil
+}
+
+// uniqueStrings returns the values without duplicates in the same order.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		unique = append(unique, v)
+	}
+	return unique
+}
@@ -0,0 +1,190 @@
+package autoupdate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/dsmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// historyDatastore is a datastore that returns a fixed history.
+type historyDatastore struct {
+	positionDatastore
+	history map[string][]datastore.HistoryInformation
+}
+
+func (ds historyDatastore) HistoryInformation(ctx context.Context, fqids ...string) (map[string][]datastore.HistoryInformation, error) {
+	history := make(map[string][]datastore.HistoryInformation)
+	for _, fqid := range fqids {
+		history[fqid] = ds.history[fqid]
+	}
+	return history, nil
+}
+
+func TestHistoryInformation(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := []byte(`["changed"]`)
+	ds := historyDatastore{
+		positionDatastore: positionDatastore{
+			MockDatastore: dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+			user/1/group_$1_ids: [1]
+			group/1/meeting_id: 1
+			group/1/permissions: [meeting.can_see_history]
+			meeting/1/admin_group_id: 2
+			motion/1/meeting_id: 1
+			motion/2/meeting_id: 1
+			`)),
+		},
+		history: map[string][]datastore.HistoryInformation{
+			"motion/1": {
+				{Position: 1, Timestamp: 100, UserID: 5, Information: info},
+				{Position: 3, Timestamp: 300, UserID: 6, Information: info},
+				{Position: 4, Timestamp: 400, UserID: 5, Information: info},
+			},
+			"motion/2": {
+				{Position: 2, Timestamp: 200, UserID: 5, Information: info},
+				{Position: 3, Timestamp: 300, UserID: 6, Information: info},
+			},
+		},
+	}
+
+	s := autoupdate.New(ds, test.RestrictAllowed, "")
+
+	for _, tt := range []struct {
+		name   string
+		query  autoupdate.HistoryQuery
+		total  int
+		expect []string
+	}{
+		{
+			"one fqid",
+			autoupdate.HistoryQuery{FQIDs: []string{"motion/2"}},
+			2,
+			[]string{"motion/2@2", "motion/2@3"},
+		},
+		{
+			"many fqids",
+			autoupdate.HistoryQuery{FQIDs: []string{"motion/1", "motion/2"}},
+			5,
+			[]string{"motion/1@1", "motion/2@2", "motion/1@3", "motion/2@3", "motion/1@4"},
+		},
+		{
+			"user",
+			autoupdate.HistoryQuery{FQIDs: []string{"motion/1", "motion/2"}, UserID: 5},
+			3,
+			[]string{"motion/1@1", "motion/2@2", "motion/1@4"},
+		},
+		{
+			"time range",
+			autoupdate.HistoryQuery{FQIDs: []string{"motion/1", "motion/2"}, Since: 200, Until: 300},
+			3,
+			[]string{"motion/2@2", "motion/1@3", "motion/2@3"},
+		},
+		{
+			"paged",
+			autoupdate.HistoryQuery{FQIDs: []string{"motion/1", "motion/2"}, Offset: 1, Limit: 2},
+			5,
+			[]string{"motion/2@2", "motion/1@3"},
+		},
+		{
+			"offset after end",
+			autoupdate.HistoryQuery{FQIDs: []string{"motion/1"}, Offset: 10},
+			3,
+			[]string{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.HistoryInformation(shutdownCtx, 1, tt.query)
+			require.NoError(t, err)
+
+			got := make([]string, len(page.Entries))
+			for i, entry := range page.Entries {
+				got[i] = fmt.Sprintf("%s@%d", entry.FQID, entry.Position)
+			}
+
+			assert.Equal(t, tt.total, page.Total)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+
+	t.Run("no permission", func(t *testing.T) {
+		_, err := s.HistoryInformation(shutdownCtx, 2, autoupdate.HistoryQuery{FQIDs: []string{"motion/1"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestFieldHistory(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := []byte(`["changed"]`)
+	ds := historyDatastore{
+		positionDatastore: positionDatastore{
+			MockDatastore: dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+			user/1/group_$1_ids: [1]
+			group/1/meeting_id: 1
+			group/1/permissions: [meeting.can_see_history]
+			meeting/1/admin_group_id: 2
+			motion/1/meeting_id: 1
+			`)),
+			positions: map[int]map[string][]byte{
+				1: dsmock.YAMLData(`motion/1/title: first`),
+				2: dsmock.YAMLData(`motion/1/title: first`),
+				3: dsmock.YAMLData(`motion/1/title: second`),
+				4: dsmock.YAMLData(`motion/1/id: 1`),
+			},
+		},
+		history: map[string][]datastore.HistoryInformation{
+			"motion/1": {
+				{Position: 1, Timestamp: 100, UserID: 5, Information: info},
+				{Position: 2, Timestamp: 200, UserID: 5, Information: info},
+				{Position: 3, Timestamp: 300, UserID: 6, Information: info},
+				{Position: 4, Timestamp: 400, UserID: 6, Information: info},
+			},
+		},
+	}
+
+	t.Run("unrestricted", func(t *testing.T) {
+		s := autoupdate.New(ds, test.RestrictAllowed, "").Unrestricted()
+
+		changes, err := s.FieldHistory(shutdownCtx, 1, "motion/1/title")
+		require.NoError(t, err)
+
+		expect := []autoupdate.FieldChange{
+			{Position: 1, Timestamp: 100, UserID: 5, Value: []byte(`"first"`)},
+			{Position: 3, Timestamp: 300, UserID: 6, Value: []byte(`"second"`)},
+			{Position: 4, Timestamp: 400, UserID: 6},
+		}
+		assert.Equal(t, expect, changes)
+	})
+
+	t.Run("not meeting admin", func(t *testing.T) {
+		s := autoupdate.New(ds, test.RestrictAllowed, "")
+
+		changes, err := s.FieldHistory(shutdownCtx, 1, "motion/1/title")
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	for _, fqfield := range []string{"motion/1", "motion/abc/title", "motion/1/"} {
+		t.Run("invalid fqfield "+fqfield, func(t *testing.T) {
+			s := autoupdate.New(ds, test.RestrictAllowed, "")
+
+			_, err := s.FieldHistory(shutdownCtx, 1, fqfield)
+
+			var errTyped interface{ Type() string }
+			if !errors.As(err, &errTyped) || errTyped.Type() != "invalid_request" {
+				t.Errorf("FieldHistory() returned `%v`, expected an invalid request error", err)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package autoupdate
 
 import (
 	"context"
-	"io"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
 )
@@ -12,12 +11,13 @@ type Datastore interface {
 	Get(ctx context.Context, keys ...string) (map[string][]byte, error)
 	GetPosition(ctx context.Context, position int, keys ...string) (map[string][]byte, error)
 	RegisterChangeListener(f func(map[string][]byte) error)
+	RegisterFullUpdateListener(f func())
 	ResetCache()
 	RegisterCalculatedField(
 		field string,
 		f func(ctx context.Context, key string, changed map[string][]byte) ([]byte, error),
 	)
-	HistoryInformation(ctx context.Context, fqid string, w io.Writer) error
+	HistoryInformation(ctx context.Context, fqids ...string) (map[string][]datastore.HistoryInformation, error)
 }
 
 // KeysBuilder holds the keys that are requested by a user.
@@ -25,3 +25,9 @@ type KeysBuilder interface {
 	Update(ctx context.Context, ds datastore.Getter) error
 	Keys() []string
 }
+
+// keysChanger is a KeysBuilder where bodies can be added or removed while the
+// connection is running.
+type keysChanger interface {
+	Changed() bool
+}
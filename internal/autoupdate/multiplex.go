@@ -0,0 +1,231 @@
+package autoupdate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+)
+
+// Multiplex creates a connection with many named subscriptions. Each
+// subscription has its own keysbuilder.
+//
+// The returned MessageProvider returns one message for each subscription with
+// new data. The name of the subscription is in Message.Subscription. The first
+// messages contain all values of each subscription. Restricting the data is
+// done once for all subscriptions.
+//
+// If listDiff is true, changed lists are returned as Message.ListDiff like
+// with Resume.
+//
+// kbs needs at least one subscription. Otherwise the MessageProvider returns
+// an invalid request error.
+func (a *Autoupdate) Multiplex(userID int, kbs map[string]KeysBuilder, listDiff bool) MessageProvider {
+	c := &multiplexConnection{
+		autoupdate:    a,
+		uid:           userID,
+		subscriptions: make(map[string]*subscription, len(kbs)),
+	}
+
+	for name, kb := range kbs {
+		c.subscriptions[name] = &subscription{
+			kb:     kb,
+			filter: filter{listDiff: listDiff},
+		}
+	}
+
+	return c.Next
+}
+
+// subscription is one keysbuilder of a multiplexed connection.
+type subscription struct {
+	kb     KeysBuilder
+	filter filter
+}
+
+// multiplexConnection is like a connection but with many subscriptions.
+type multiplexConnection struct {
+	autoupdate    *Autoupdate
+	uid           int
+	tid           uint64
+	subscriptions map[string]*subscription
+	hotkeys       map[string]bool
+	started       bool
+
+	// pending are messages, that where created but not returned yet.
+	pending []Message
+}
+
+// Next returns the next message of a subscription.
+//
+// When Next is called for the first time, it does not block. It returns a
+// message for each subscription, even if the data is empty. Afterwards it
+// blocks until there is new data for a subscription.
+func (c *multiplexConnection) Next(ctx context.Context) (Message, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+
+	if !c.started {
+		if len(c.subscriptions) == 0 {
+			return Message{}, invalidRequestError{"multiplex needs at least one subscription"}
+		}
+		c.started = true
+
+		msgs, err := c.data(ctx, true)
+		if err != nil {
+			return Message{}, fmt.Errorf("creating first time data: %w", err)
+		}
+
+		for i := range msgs {
+			msgs[i].Full = true
+		}
+
+		return c.next(msgs), nil
+	}
+
+	for {
+		// Blocks until the topic is closed (on server exit) or the context is done.
+		tid, changedKeys, err := c.autoupdate.topic.Receive(ctx, c.tid)
+		if err != nil {
+			return Message{}, fmt.Errorf("get updated keys: %w", err)
+		}
+		lastTID := c.tid
+		c.tid = tid
+
+		for _, key := range changedKeys {
+			if c.hotkeys[key] || isFullUpdate(key, c.uid) {
+				msgs, err := c.data(ctx, false)
+				if err != nil {
+					// Receive the same keys again on the next call.
+					c.tid = lastTID
+					return Message{}, fmt.Errorf("creating later data: %w", err)
+				}
+
+				if len(msgs) > 0 {
+					return c.next(msgs), nil
+				}
+				break
+			}
+		}
+	}
+}
+
+// next returns the first message and remembers the others.
+func (c *multiplexConnection) next(msgs []Message) Message {
+	c.pending = msgs[1:]
+	return msgs[0]
+}
+
+// data returns a message for each subscription with changed values. If all is
+// true, a message is returned for each subscription, even if there are no
+// changed values.
+//
+// The keysbuilders of all subscriptions use the same restricter. Values that
+// are needed by more then one subscription are only restricted once.
+func (c *multiplexConnection) data(ctx context.Context, all bool) ([]Message, error) {
+	if c.tid == 0 {
+		c.tid = c.autoupdate.topic.LastID()
+	}
+
+	recorder := datastore.NewRecorder(c.autoupdate.datastore)
+	restricter := newMemoGetter(c.autoupdate.restricter(recorder, c.uid))
+
+	names := make([]string, 0, len(c.subscriptions))
+	for name := range c.subscriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var allKeys []string
+	for _, name := range names {
+		sub := c.subscriptions[name]
+		oldKeys := sub.kb.Keys()
+
+		if err := sub.kb.Update(ctx, restricter); err != nil {
+			return nil, fmt.Errorf("create keys for keysbuilder of subscription %s: %w", name, err)
+		}
+
+		for _, key := range notInSlice(oldKeys, sub.kb.Keys()) {
+			sub.filter.delete(key)
+		}
+		allKeys = append(allKeys, sub.kb.Keys()...)
+	}
+
+	data, err := restricter.Get(ctx, allKeys...)
+	if err != nil {
+		return nil, fmt.Errorf("get restricted data: %w", err)
+	}
+	c.hotkeys = recorder.Keys()
+
+	var msgs []Message
+	for _, name := range names {
+		sub := c.subscriptions[name]
+
+		keys := sub.kb.Keys()
+		subData := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			subData[key] = data[key]
+		}
+
+		msg := Message{
+			ID:           c.autoupdate.messageID(c.tid),
+			Subscription: name,
+			Data:         subData,
+			ListDiff:     sub.filter.filter(subData),
+		}
+
+		if all || !msg.empty() {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	return msgs, nil
+}
+
+// memoGetter remembers the values from a getter, so each key is only fetched
+// once.
+type memoGetter struct {
+	getter datastore.Getter
+	values map[string][]byte
+}
+
+func newMemoGetter(getter datastore.Getter) *memoGetter {
+	return &memoGetter{
+		getter: getter,
+		values: make(map[string][]byte),
+	}
+}
+
+// Get returns the values for the keys. Only keys, that where not requested
+// before, are fetched from the underlying getter.
+func (g *memoGetter) Get(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if _, ok := g.values[key]; !ok && !seen[key] {
+			missing = append(missing, key)
+			seen[key] = true
+		}
+	}
+
+	if len(missing) > 0 {
+		data, err := g.getter.Get(ctx, missing...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range missing {
+			g.values[key] = data[key]
+		}
+	}
+
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		values[key] = g.values[key]
+	}
+	return values, nil
+}
@@ -0,0 +1,147 @@
+package autoupdate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/keysbuilder"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/dsmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiplex(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+	user/1/name: Hello
+	user/2/name: World
+	`))
+	go datastore.ListenOnUpdates(shutdownCtx, nil)
+
+	s := autoupdate.New(datastore, test.RestrictAllowed, "")
+	next := s.Multiplex(1, map[string]autoupdate.KeysBuilder{
+		"first":  test.KeysBuilder{K: test.Str("user/1/name")},
+		"second": test.KeysBuilder{K: test.Str("user/1/name", "user/2/name")},
+		"empty":  test.KeysBuilder{},
+	}, false)
+
+	var first []autoupdate.Message
+	for i := 0; i < 3; i++ {
+		msg, err := next(shutdownCtx)
+		require.NoError(t, err)
+		first = append(first, msg)
+	}
+
+	assert.Equal(t, []autoupdate.Message{
+		{ID: s.LastID(), Full: true, Subscription: "empty", Data: map[string][]byte{}},
+		{ID: s.LastID(), Full: true, Subscription: "first", Data: map[string][]byte{"user/1/name": []byte(`"Hello"`)}},
+		{ID: s.LastID(), Full: true, Subscription: "second", Data: map[string][]byte{"user/1/name": []byte(`"Hello"`), "user/2/name": []byte(`"World"`)}},
+	}, first)
+
+	datastore.Send(map[string][]byte{"user/2/name": []byte(`"Hubert"`)})
+
+	msg, err := next(shutdownCtx)
+	require.NoError(t, err)
+
+	assert.Equal(t, "second", msg.Subscription)
+	assert.Equal(t, map[string][]byte{"user/2/name": []byte(`"Hubert"`)}, msg.Data)
+
+	if !blocking(func() { next(shutdownCtx) }) {
+		t.Errorf("next() did not block after all messages where returned")
+	}
+}
+
+func TestMultiplexWithoutSubscriptions(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := dsmock.NewMockDatastore(shutdownCtx.Done(), nil)
+	s := autoupdate.New(datastore, test.RestrictAllowed, "")
+
+	_, err := s.Multiplex(1, map[string]autoupdate.KeysBuilder{}, false)(shutdownCtx)
+
+	var errTyped interface{ Type() string }
+	if !errors.As(err, &errTyped) || errTyped.Type() != "invalid_request" {
+		t.Errorf("next() returned `%v`, expected an invalid request error", err)
+	}
+}
+
+func TestMultiplexRetryAfterFailedData(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datastore := dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+	user/1/name: Hello
+	`))
+	go datastore.ListenOnUpdates(shutdownCtx, nil)
+
+	s := autoupdate.New(datastore, test.RestrictAllowed, "")
+	next := s.Multiplex(1, map[string]autoupdate.KeysBuilder{
+		"first": test.KeysBuilder{K: test.Str("user/1/name")},
+	}, false)
+
+	_, err := next(shutdownCtx)
+	require.NoError(t, err)
+
+	datastore.InjectError(errors.New("my error"))
+	datastore.Send(map[string][]byte{"user/1/name": []byte(`"new value"`)})
+	_, err = next(shutdownCtx)
+	require.Error(t, err)
+	datastore.InjectError(nil)
+
+	ctx, cancelNext := context.WithTimeout(shutdownCtx, time.Second)
+	defer cancelNext()
+	msg, err := next(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"user/1/name": []byte(`"new value"`)}, msg.Data)
+}
+
+func TestMultiplexSharedRestricter(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := dsmock.NewMockDatastore(shutdownCtx.Done(), dsmock.YAMLData(`---
+	user/1/name: Hello
+	user/2/name: World
+	`))
+
+	restricted := make(map[string]int)
+	restricter := func(getter datastore.Getter, uid int) datastore.Getter {
+		return countingGetter{getter: getter, count: restricted}
+	}
+
+	kb1, err := keysbuilder.FromKeys([]string{"user/1/name", "user/2/name"})
+	require.NoError(t, err)
+	kb2, err := keysbuilder.FromKeys([]string{"user/1/name"})
+	require.NoError(t, err)
+
+	s := autoupdate.New(ds, restricter, "")
+	next := s.Multiplex(1, map[string]autoupdate.KeysBuilder{"first": kb1, "second": kb2}, false)
+
+	if _, err := next(shutdownCtx); err != nil {
+		t.Fatalf("next() returned an error: %v", err)
+	}
+
+	assert.Equal(t, map[string]int{"user/1/name": 1, "user/2/name": 1}, restricted)
+}
+
+// countingGetter counts how often each key is requested.
+type countingGetter struct {
+	getter datastore.Getter
+	count  map[string]int
+}
+
+func (g countingGetter) Get(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	for _, k := range keys {
+		g.count[k]++
+	}
+	return g.getter.Get(ctx, keys...)
+}
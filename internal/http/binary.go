@@ -0,0 +1,135 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// binaryEncoding is a compact binary format for the messages.
+//
+// Maps are encoded as binary maps with string keys. The values from the
+// datastore are not decoded but sent as binary strings that contain the raw
+// json.
+type binaryEncoding struct {
+	name        string
+	contentType string
+	marshal     func(v any) ([]byte, error)
+}
+
+var binaryEncodings = []binaryEncoding{
+	{
+		name:        "msgpack",
+		contentType: "application/msgpack",
+		marshal:     marshalMsgpack,
+	},
+	{
+		name:        "cbor",
+		contentType: "application/cbor",
+		marshal:     marshalCBOR,
+	},
+}
+
+// binaryEncodingFromRequest returns the binary encoding the client asked for
+// with the query parameter `encoding` or the Accept header.
+//
+// The second return value is false, if the client did not ask for a binary
+// encoding.
+func binaryEncodingFromRequest(r *http.Request) (binaryEncoding, bool) {
+	name := r.URL.Query().Get("encoding")
+	accept := r.Header.Get("Accept")
+	for _, enc := range binaryEncodings {
+		if name == enc.name || strings.Contains(accept, enc.contentType) {
+			return enc, true
+		}
+	}
+	return binaryEncoding{}, false
+}
+
+// marshalMsgpack encodes a value with msgpack. Struct fields use the names from
+// the json tags. Map keys are sorted, so the same value is always encoded the
+// same way.
+func marshalMsgpack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cborMode encodes cbor with sorted map keys.
+var cborMode, _ = cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+
+// marshalCBOR encodes a value with cbor. Map keys are sorted, so the same value
+// is always encoded the same way.
+func marshalCBOR(v any) ([]byte, error) {
+	return cborMode.Marshal(v)
+}
+
+// encode writes v to w.
+func (e binaryEncoding) encode(w io.Writer, v any) error {
+	bs, err := e.marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", e.name, err)
+	}
+
+	_, err = w.Write(bs)
+	return err
+}
+
+// binaryFormat writes each message as a binary map. The messages are written
+// one after another without a separator.
+//
+// If envelope is true, the message is sent together with its id and list diffs.
+// If nested is true, the data is sent as nested maps.
+type binaryFormat struct {
+	encoding binaryEncoding
+	envelope bool
+	nested   bool
+}
+
+func (f binaryFormat) contentType() string {
+	return f.encoding.contentType
+}
+
+func (f binaryFormat) message(w io.Writer, msg autoupdate.Message) error {
+	out := encodeData(msg.Data, f.nested)
+	if f.envelope {
+		out = newMessageEnvelope(msg, f.nested)
+	}
+
+	return f.encoding.encode(w, out)
+}
+
+func (f binaryFormat) error(w io.Writer, msg string) error {
+	var decoded any
+	if err := json.Unmarshal([]byte(msg), &decoded); err != nil {
+		return fmt.Errorf("decoding error message: %w", err)
+	}
+
+	return f.encoding.encode(w, decoded)
+}
+
+func (f binaryFormat) heartbeat(w io.Writer) error {
+	if f.envelope {
+		return f.encoding.encode(w, heartbeatEnvelope{Heartbeat: true})
+	}
+
+	// An empty map is a message without changed values.
+	return f.encoding.encode(w, map[string]any{})
+}
+
+func (f binaryFormat) reconnect(w io.Writer, delay time.Duration) error {
+	return f.encoding.encode(w, newReconnectMessage(delay))
+}
@@ -0,0 +1,118 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestBinaryEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		url         string
+		accept      string
+		contentType string
+		unmarshal   func([]byte, any) error
+	}{
+		{
+			"msgpack query single",
+			"/system/autoupdate?k=user/1/name&single=1&encoding=msgpack",
+			"",
+			"application/msgpack",
+			msgpack.Unmarshal,
+		},
+		{
+			"msgpack accept streaming",
+			"/system/autoupdate?k=user/1/name",
+			"application/msgpack",
+			"application/msgpack",
+			msgpack.Unmarshal,
+		},
+		{
+			"cbor query streaming",
+			"/system/autoupdate?k=user/1/name&encoding=cbor",
+			"",
+			"application/cbor",
+			cbor.Unmarshal,
+		},
+		{
+			"cbor accept single",
+			"/system/autoupdate?k=user/1/name&single=1",
+			"application/cbor",
+			"application/cbor",
+			cbor.Unmarshal,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					cancel()
+					return map[string][]byte{"user/1/name": []byte(`"bar"`)}, nil
+				},
+			}
+
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+			req := httptest.NewRequest("GET", tt.url, nil).WithContext(ctx)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if got := rec.Result().Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Got content type %q, expected %q", got, tt.contentType)
+			}
+
+			var got map[string][]byte
+			if err := tt.unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+
+			if v := got["user/1/name"]; !bytes.Equal(v, []byte(`"bar"`)) || len(got) != 1 {
+				t.Errorf("Got %v, expected map with user/1/name: \"bar\"", got)
+			}
+		})
+	}
+}
+
+func TestBinaryEncodingResumable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux := http.NewServeMux()
+	connecter := &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			cancel()
+			return map[string][]byte{"user/1/name": []byte(`"bar"`)}, nil
+		},
+	}
+
+	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+	req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name&encoding=msgpack&resumable=1", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var got struct {
+		ID   string            `msgpack:"id"`
+		Full bool              `msgpack:"full"`
+		Data map[string][]byte `msgpack:"data"`
+	}
+	if err := msgpack.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+
+	if got.ID != "1" || !got.Full || !bytes.Equal(got.Data["user/1/name"], []byte(`"bar"`)) {
+		t.Errorf("Got %v, expected id 1, full and user/1/name", got)
+	}
+}
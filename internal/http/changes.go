@@ -0,0 +1,120 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/keysbuilder"
+)
+
+// Changer returns the values, that are different between two positions.
+type Changer interface {
+	Changes(ctx context.Context, userID int, kb autoupdate.KeysBuilder, from, to int) (map[string]autoupdate.Change, error)
+}
+
+// Changes registers the route to return the changed values between two
+// positions.
+//
+// The keys are requested like with the autoupdate route. The positions are
+// read from the query parameters `from` and `to`.
+func Changes(mux *http.ServeMux, auth Authenticater, changer Changer) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store, max-age=0")
+
+		defer r.Body.Close()
+		uid := auth.FromContext(r.Context())
+
+		from, err := positionFromQuery(r, "from")
+		if err != nil {
+			handleError(w, err, true)
+			return
+		}
+
+		to, err := positionFromQuery(r, "to")
+		if err != nil {
+			handleError(w, err, true)
+			return
+		}
+
+		queryBuilder, err := keysbuilder.FromKeys(strings.Split(r.URL.Query().Get("k"), ","))
+		if err != nil {
+			handleError(w, fmt.Errorf("building keysbuilder from query: %w", err), true)
+			return
+		}
+
+		bodyBuilder, err := keysbuilder.ManyFromJSON(r.Body)
+		if err != nil {
+			handleError(w, fmt.Errorf("building keysbuilder from body: %w", err), true)
+			return
+		}
+
+		changes, err := changer.Changes(r.Context(), uid, keysbuilder.FromBuilders(queryBuilder, bodyBuilder), from, to)
+		if err != nil {
+			handleError(w, fmt.Errorf("getting changes: %w", err), true)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(convertChanges(changes)); err != nil {
+			handleError(w, fmt.Errorf("encoding changes: %w", err), true)
+			return
+		}
+	})
+
+	mux.Handle(
+		prefixPublic+"/changes",
+		validRequest(
+			authMiddleware(
+				compressMiddleware(handler),
+				auth,
+			),
+		),
+	)
+}
+
+// positionFromQuery reads a required position from the query parameter with
+// the given name.
+func positionFromQuery(r *http.Request, name string) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, invalidRequestError{fmt.Errorf("query parameter `%s` is required", name)}
+	}
+
+	position, err := strconv.Atoi(raw)
+	if err != nil || position < 1 {
+		return 0, invalidRequestError{fmt.Errorf("%s has to be a positive number, not %s", name, raw)}
+	}
+	return position, nil
+}
+
+// changeValue is the json representation of one changed key.
+type changeValue struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// convertChanges converts the changes to a map, that can be encoded as json.
+//
+// Keys, that do not exist at a position, are encoded as null.
+func convertChanges(changes map[string]autoupdate.Change) map[string]changeValue {
+	converted := make(map[string]changeValue, len(changes))
+	for key, change := range changes {
+		converted[key] = changeValue{
+			Old: rawOrNull(change.Old),
+			New: rawOrNull(change.New),
+		}
+	}
+	return converted
+}
+
+func rawOrNull(value []byte) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
@@ -0,0 +1,83 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+)
+
+// changerMock returns one change for each requested key.
+type changerMock struct{}
+
+func (changerMock) Changes(ctx context.Context, userID int, kb autoupdate.KeysBuilder, from, to int) (map[string]autoupdate.Change, error) {
+	if err := kb.Update(ctx, nil); err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]autoupdate.Change)
+	for _, key := range kb.Keys() {
+		changes[key] = autoupdate.Change{Old: []byte(`"old"`)}
+		if from != to {
+			changes[key] = autoupdate.Change{Old: []byte(`"old"`), New: []byte(`"new"`)}
+		}
+	}
+	return changes, nil
+}
+
+func TestChanges(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		url          string
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			"changed",
+			"/system/autoupdate/changes?k=user/1/name&from=1&to=2",
+			200,
+			`{"user/1/name":{"old":"old","new":"new"}}` + "\n",
+		},
+		{
+			"deleted",
+			"/system/autoupdate/changes?k=user/1/name&from=1&to=1",
+			200,
+			`{"user/1/name":{"old":"old","new":null}}` + "\n",
+		},
+		{
+			"without from",
+			"/system/autoupdate/changes?k=user/1/name&to=2",
+			400,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: query parameter ` + "`from`" + ` is required"}}`,
+		},
+		{
+			"invalid to",
+			"/system/autoupdate/changes?k=user/1/name&from=1&to=abc",
+			400,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: to has to be a positive number, not abc"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			ahttp.Changes(mux, test.Auth(1), changerMock{})
+
+			req := httptest.NewRequest("GET", tt.url, strings.NewReader(""))
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectStatus {
+				t.Errorf("Got status %d, expected %d", rec.Code, tt.expectStatus)
+			}
+
+			if got, _ := io.ReadAll(rec.Result().Body); string(got) != tt.expectBody {
+				t.Errorf("Got body %q, expected %q", got, tt.expectBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressor is a writer that compresses the data.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter is a http.ResponseWriter that compresses the body.
+//
+// The status and the header Content-Encoding are only sent with the first
+// write. Responses without a body, for example with the status 304, are sent
+// without Content-Encoding.
+//
+// Flush() flushes the compressor and the underlying ResponseWriter, so each
+// message reaches the client immediately.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor compressor
+	encoding   string
+	status     int
+	started    bool
+}
+
+// WriteHeader remembers the status. It is sent with the first write or when
+// the writer is closed.
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	w.start()
+	return w.compressor.Write(p)
+}
+
+// start sends the header Content-Encoding and the status.
+func (w *compressWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	w.Header().Set("Content-Encoding", w.encoding)
+	w.Header().Del("Content-Length")
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// close finishes the compressed body. Responses without a body only get the
+// status.
+func (w *compressWriter) close() error {
+	if !w.started {
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return nil
+	}
+	return w.compressor.Close()
+}
+
+func (w *compressWriter) Flush() {
+	w.start()
+
+	// Errors are returned on the next write.
+	_ = w.compressor.Flush()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// compressMiddleware compresses the response with gzip or deflate, if the
+// client supports it.
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+
+		var c compressor
+		switch encoding {
+		case "gzip":
+			c = gzip.NewWriter(w)
+		case "deflate":
+			c = zlib.NewWriter(w)
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		next.ServeHTTP(cw, r)
+
+		// When the client is gone, the end of the body can not be written.
+		if err := cw.close(); err != nil && r.Context().Err() == nil {
+			log.Printf("Error closing compressed response: %v", err)
+		}
+	})
+}
+
+// acceptedEncoding returns the compression from the Accept-Encoding header,
+// that should be used.
+//
+// gzip is preferred over deflate. Encodings with a quality value of 0 are not
+// used. If no supported encoding is accepted, an empty string is returned.
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		encoding, params, _ := strings.Cut(part, ";")
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+
+		params = strings.TrimSpace(params)
+		if strings.HasPrefix(params, "q=") {
+			if quality, err := strconv.ParseFloat(params[2:], 64); err == nil && quality == 0 {
+				continue
+			}
+		}
+
+		accepted[encoding] = true
+	}
+
+	switch {
+	case accepted["gzip"] || accepted["*"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,100 @@
+package http_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+)
+
+func TestCompression(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		acceptEncoding string
+		expectEncoding string
+		reader         func(io.Reader) (io.Reader, error)
+	}{
+		{
+			"gzip",
+			"gzip, deflate",
+			"gzip",
+			func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		},
+		{
+			"deflate",
+			"deflate",
+			"deflate",
+			func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		},
+		{
+			"gzip not acceptable",
+			"gzip;q=0, deflate",
+			"deflate",
+			func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		},
+		{
+			"no compression",
+			"br",
+			"",
+			func(r io.Reader) (io.Reader, error) { return r, nil },
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			var called bool
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					if called {
+						<-ctx.Done()
+						return nil, ctx.Err()
+					}
+					called = true
+					return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+				},
+			}
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			req, err := http.NewRequest("GET", srv.URL+"/system/autoupdate?k=user/1/name", nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); got != tt.expectEncoding {
+				t.Errorf("Got Content-Encoding %q, expected %q", got, tt.expectEncoding)
+			}
+
+			// The connection is still open. The first message can only be
+			// read, if the compressor was flushed.
+			body, err := tt.reader(resp.Body)
+			if err != nil {
+				t.Fatalf("creating reader: %v", err)
+			}
+
+			line, err := bufio.NewReader(body).ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading first message: %v", err)
+			}
+
+			if expect := `{"foo":"bar"}` + "\n"; line != expect {
+				t.Errorf("Got %q, expected %q", line, expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Drainer tells the open streams to reconnect, when the service shuts down.
+//
+// Each stream gets a reconnect message with a random delay, so the clients do
+// not reconnect all at the same time.
+//
+// It has to be created with NewDrainer(). A nil Drainer can be used and never
+// drains.
+type Drainer struct {
+	maxDelay time.Duration
+
+	once     sync.Once
+	draining chan struct{}
+
+	// mu protects streams and random. A rand.Rand is not safe for concurrent
+	// use.
+	mu      sync.Mutex
+	streams int
+	random  *rand.Rand
+}
+
+// NewDrainer initializes a Drainer. The delay, that the clients should wait
+// before they reconnect, is between 0 and maxDelay.
+func NewDrainer(maxDelay time.Duration) *Drainer {
+	return &Drainer{
+		maxDelay: maxDelay,
+		draining: make(chan struct{}),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Drain tells all open streams to send a reconnect message and to close.
+// Streams, that are opened afterwards, are closed immediately.
+//
+// Blocks until all streams are closed or the context is done.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.once.Do(func() { close(d.draining) })
+
+	// Poll like http.Server.Shutdown does.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if d.openStreams() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Drainer) openStreams() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.streams
+}
+
+func (d *Drainer) addStream(delta int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.streams += delta
+}
+
+// stream registers a streaming connection. The returned context is canceled,
+// when the Drainer starts to drain. The returned function has to be called,
+// when the stream is closed.
+func (d *Drainer) stream(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if d == nil {
+		return ctx, cancel
+	}
+
+	d.addStream(1)
+
+	select {
+	case <-d.draining:
+		// Already draining. Close the new stream immediately.
+		cancel()
+	default:
+	}
+
+	go func() {
+		select {
+		case <-d.draining:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		d.addStream(-1)
+	}
+}
+
+// delay returns a random delay for a client to reconnect.
+func (d *Drainer) delay() time.Duration {
+	if d == nil || d.maxDelay <= 0 {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Duration(d.random.Int63n(int64(d.maxDelay)))
+}
+
+// reconnectMessage tells the client to close the connection and to reconnect
+// after the delay.
+type reconnectMessage struct {
+	Reconnect reconnectDelay `json:"reconnect"`
+}
+
+type reconnectDelay struct {
+	RetryMS int64 `json:"retry_ms"`
+}
+
+func newReconnectMessage(delay time.Duration) reconnectMessage {
+	return reconnectMessage{reconnectDelay{delay.Milliseconds()}}
+}
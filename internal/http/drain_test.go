@@ -0,0 +1,132 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+	"golang.org/x/net/websocket"
+)
+
+// blockingConnecter returns one message and then blocks until the context is
+// done.
+func blockingConnecter() *connecterMock {
+	var called bool
+	return &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			if called {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			called = true
+			return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+		},
+	}
+}
+
+func TestDrain(t *testing.T) {
+	drainer := ahttp.NewDrainer(time.Second)
+
+	mux := http.NewServeMux()
+	ahttp.Autoupdate(mux, test.Auth(1), blockingConnecter(), nil, nil, drainer, 0)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/system/autoupdate?k=user/1/name")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("reading first message: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := drainer.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading reconnect message: %v", err)
+	}
+
+	var got struct {
+		Reconnect struct {
+			RetryMS *int64 `json:"retry_ms"`
+		} `json:"reconnect"`
+	}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("decoding reconnect message %q: %v", line, err)
+	}
+
+	if got.Reconnect.RetryMS == nil || *got.Reconnect.RetryMS < 0 || *got.Reconnect.RetryMS >= 1000 {
+		t.Errorf("Got reconnect message %q, expected retry_ms between 0 and 1000", line)
+	}
+}
+
+func TestDrainEventStream(t *testing.T) {
+	drainer := ahttp.NewDrainer(0)
+	if err := drainer.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	ahttp.Autoupdate(mux, test.Auth(1), blockingConnecter(), nil, nil, drainer, 0)
+
+	req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name&sse=1", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	expect := "event: reconnect\nretry: 0\ndata: {\"retry_ms\":0}\n\n"
+	if got := rec.Body.String(); got != expect {
+		t.Errorf("Got %q, expected %q", got, expect)
+	}
+}
+
+func TestDrainWebsocket(t *testing.T) {
+	drainer := ahttp.NewDrainer(0)
+
+	mux := http.NewServeMux()
+	ahttp.Websocket(mux, test.Auth(1), blockingConnecter(), nil, nil, drainer, nil)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/system/autoupdate/websocket?k=user/1/name"
+	conn, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	var got string
+	if err := websocket.Message.Receive(conn, &got); err != nil {
+		t.Fatalf("Receive first message: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := drainer.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if err := websocket.Message.Receive(conn, &got); err != nil {
+		t.Fatalf("Receive reconnect message: %v", err)
+	}
+
+	if expect := `{"reconnect":{"retry_ms":0}}`; got != expect {
+		t.Errorf("Got frame %q, expected %q", got, expect)
+	}
+}
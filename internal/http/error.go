@@ -1,6 +1,9 @@
 package http
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
 
 type invalidRequestError struct {
 	err error
@@ -13,3 +16,33 @@ func (e invalidRequestError) Error() string {
 func (e invalidRequestError) Type() string {
 	return "invalid_request"
 }
+
+type tooManyConnectionsError struct {
+	msg string
+}
+
+func (e tooManyConnectionsError) Error() string {
+	return e.msg
+}
+
+func (e tooManyConnectionsError) Type() string {
+	return "too_many_connections"
+}
+
+func (e tooManyConnectionsError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+type internalAuthError struct{}
+
+func (e internalAuthError) Error() string {
+	return "invalid or missing service secret"
+}
+
+func (e internalAuthError) Type() string {
+	return "auth"
+}
+
+func (e internalAuthError) StatusCode() int {
+	return http.StatusUnauthorized
+}
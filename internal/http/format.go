@@ -0,0 +1,234 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+)
+
+// streamFormat defines, how the messages of a streaming response are written.
+type streamFormat interface {
+	// contentType is the value for the Content-Type header.
+	contentType() string
+
+	// message writes one message.
+	message(w io.Writer, msg autoupdate.Message) error
+
+	// error writes an error message, that was created with errorMessage().
+	error(w io.Writer, msg string) error
+
+	// heartbeat writes a message, that is ignored by the client.
+	heartbeat(w io.Writer) error
+
+	// reconnect writes a message, that tells the client to reconnect after the
+	// delay.
+	reconnect(w io.Writer, delay time.Duration) error
+}
+
+// streamFormatFromRequest returns the format the client asked for.
+//
+// Server-Sent Events are used, if the Accept header contains
+// text/event-stream or the query parameter `sse` is set. If the client asked
+// for a binary encoding, the messages are sent in this encoding. Otherwise, each
+// message is a json object in its own line.
+//
+// If envelope is true, the messages are sent as messageEnvelope.
+func streamFormatFromRequest(r *http.Request, envelope bool) streamFormat {
+	nested := nestedFromRequest(r)
+	if r.URL.Query().Has("sse") || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return eventStreamFormat{nested: nested}
+	}
+
+	if encoding, ok := binaryEncodingFromRequest(r); ok {
+		return binaryFormat{encoding: encoding, envelope: envelope, nested: nested}
+	}
+
+	return jsonLinesFormat{envelope: envelope, nested: nested}
+}
+
+// nestedFromRequest returns true, if the client wants the data as nested
+// objects.
+func nestedFromRequest(r *http.Request) bool {
+	return r.URL.Query().Has("nested")
+}
+
+// convertData converts the values of a message, so they are encoded as raw
+// json.
+func convertData(data map[string][]byte) map[string]json.RawMessage {
+	converted := make(map[string]json.RawMessage, len(data))
+	for k, v := range data {
+		converted[k] = v
+	}
+	return converted
+}
+
+// nestData converts the values of a message to nested objects in the form
+// {collection: {id: {field: value}}}.
+//
+// Values that are nil are encoded as json null. Keys that are not a fqfield are
+// ignored.
+func nestData(data map[string][]byte) map[string]map[string]map[string]json.RawMessage {
+	nested := make(map[string]map[string]map[string]json.RawMessage)
+	for k, v := range data {
+		parts := strings.Split(k, "/")
+		if len(parts) != 3 {
+			continue
+		}
+
+		collection, id, field := parts[0], parts[1], parts[2]
+		if nested[collection] == nil {
+			nested[collection] = make(map[string]map[string]json.RawMessage)
+		}
+
+		if nested[collection][id] == nil {
+			nested[collection][id] = make(map[string]json.RawMessage)
+		}
+
+		if v == nil {
+			v = []byte("null")
+		}
+		nested[collection][id][field] = v
+	}
+	return nested
+}
+
+// encodeData returns the data of a message in the form it is sent to the
+// client.
+func encodeData(data map[string][]byte, nested bool) any {
+	if nested {
+		return nestData(data)
+	}
+	return convertData(data)
+}
+
+// messageEnvelope is the format of a message, that contains its id, the
+// subscription and the list diffs.
+type messageEnvelope struct {
+	ID           string                      `json:"id"`
+	Subscription string                      `json:"subscription,omitempty"`
+	Full         bool                        `json:"full,omitempty"`
+	Data         any                         `json:"data"`
+	ListDiff     map[string]listDiffEnvelope `json:"list_diff,omitempty"`
+}
+
+// heartbeatEnvelope is the heartbeat, when the messages are sent as
+// messageEnvelope. An empty object would look like a message without id and
+// data.
+type heartbeatEnvelope struct {
+	Heartbeat bool `json:"heartbeat"`
+}
+
+// listDiffEnvelope is the format of an autoupdate.ListDiff.
+type listDiffEnvelope struct {
+	Add    []json.RawMessage `json:"add,omitempty"`
+	Remove []json.RawMessage `json:"remove,omitempty"`
+}
+
+// newMessageEnvelope converts an autoupdate message to its output format.
+func newMessageEnvelope(msg autoupdate.Message, nested bool) messageEnvelope {
+	var diffs map[string]listDiffEnvelope
+	if len(msg.ListDiff) > 0 {
+		diffs = make(map[string]listDiffEnvelope, len(msg.ListDiff))
+		for k, v := range msg.ListDiff {
+			diffs[k] = listDiffEnvelope{Add: v.Add, Remove: v.Remove}
+		}
+	}
+
+	return messageEnvelope{
+		ID:           msg.ID,
+		Subscription: msg.Subscription,
+		Full:         msg.Full,
+		Data:         encodeData(msg.Data, nested),
+		ListDiff:     diffs,
+	}
+}
+
+// jsonLinesFormat writes each message as json object followed by a newline.
+//
+// If envelope is true, the message is sent together with its id and list diffs.
+// If nested is true, the data is sent as nested objects.
+type jsonLinesFormat struct {
+	envelope bool
+	nested   bool
+}
+
+func (f jsonLinesFormat) contentType() string {
+	return "application/octet-stream"
+}
+
+func (f jsonLinesFormat) message(w io.Writer, msg autoupdate.Message) error {
+	out := encodeData(msg.Data, f.nested)
+	if f.envelope {
+		out = newMessageEnvelope(msg, f.nested)
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+func (f jsonLinesFormat) error(w io.Writer, msg string) error {
+	_, err := fmt.Fprint(w, msg)
+	return err
+}
+
+func (f jsonLinesFormat) heartbeat(w io.Writer) error {
+	if f.envelope {
+		return json.NewEncoder(w).Encode(heartbeatEnvelope{Heartbeat: true})
+	}
+
+	// An empty object is a message without changed values.
+	_, err := fmt.Fprintln(w, "{}")
+	return err
+}
+
+func (f jsonLinesFormat) reconnect(w io.Writer, delay time.Duration) error {
+	return json.NewEncoder(w).Encode(newReconnectMessage(delay))
+}
+
+// eventStreamFormat writes the messages as Server-Sent Events.
+//
+// The data of each event is the message envelope. Errors are sent as events
+// with the type `error`. Heartbeats are comments.
+type eventStreamFormat struct {
+	nested bool
+}
+
+func (eventStreamFormat) contentType() string {
+	return "text/event-stream"
+}
+
+func (f eventStreamFormat) message(w io.Writer, msg autoupdate.Message) error {
+	bs, err := json.Marshal(newMessageEnvelope(msg, f.nested))
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", msg.ID, bs)
+	return err
+}
+
+func (eventStreamFormat) error(w io.Writer, msg string) error {
+	_, err := fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.TrimSpace(msg))
+	return err
+}
+
+func (eventStreamFormat) heartbeat(w io.Writer) error {
+	_, err := fmt.Fprint(w, ":\n\n")
+	return err
+}
+
+// reconnect sends an event with the type `reconnect`. The retry field tells an
+// EventSource to wait for the delay, before it reconnects.
+func (eventStreamFormat) reconnect(w io.Writer, delay time.Duration) error {
+	bs, err := json.Marshal(newReconnectMessage(delay).Reconnect)
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "event: reconnect\nretry: %d\ndata: %s\n\n", delay.Milliseconds(), bs)
+	return err
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+)
+
+// HistoryInformationer is an object, that can return the history information
+// for objects.
+type HistoryInformationer interface {
+	HistoryInformation(ctx context.Context, uid int, query autoupdate.HistoryQuery) (autoupdate.HistoryPage, error)
+}
+
+// HistoryInformation registers the route to return the history information
+// for one or more fqids.
+//
+// The fqids are read from the query parameter `fqid`. It can be used more then
+// once or contain a comma separated list. The entries can be filtered with the
+// query parameters `user_id`, `since` and `until` and paged with `offset` and
+// `limit`.
+func HistoryInformation(mux *http.ServeMux, auth Authenticater, hi HistoryInformationer) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		uid := auth.FromContext(r.Context())
+
+		query, err := historyQueryFromRequest(r)
+		if err != nil {
+			handleError(w, err, true)
+			return
+		}
+
+		page, err := hi.HistoryInformation(r.Context(), uid, query)
+		if err != nil {
+			handleError(w, fmt.Errorf("getting history information: %w", err), true)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			handleError(w, fmt.Errorf("encoding history information: %w", err), true)
+			return
+		}
+	})
+
+	mux.Handle(prefixPublic+"/history_information", authMiddleware(handler, auth))
+}
+
+// historyQueryFromRequest reads the history query from the query parameters.
+func historyQueryFromRequest(r *http.Request) (autoupdate.HistoryQuery, error) {
+	var query autoupdate.HistoryQuery
+	for _, value := range r.URL.Query()["fqid"] {
+		for _, fqid := range strings.Split(value, ",") {
+			if fqid != "" {
+				query.FQIDs = append(query.FQIDs, fqid)
+			}
+		}
+	}
+
+	if len(query.FQIDs) == 0 {
+		return query, invalidRequestError{fmt.Errorf("History Information needs an fqid")}
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{
+		{"user_id", &query.UserID},
+		{"since", &query.Since},
+		{"until", &query.Until},
+		{"offset", &query.Offset},
+		{"limit", &query.Limit},
+	} {
+		n, err := optionalNumberFromQuery(r, param.name)
+		if err != nil {
+			return query, err
+		}
+		*param.value = n
+	}
+
+	return query, nil
+}
+
+// optionalNumberFromQuery reads a non negative number from the query parameter
+// with the given name. If the parameter is not set, 0 is returned.
+func optionalNumberFromQuery(r *http.Request, name string) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, invalidRequestError{fmt.Errorf("%s has to be a positive number, not %s", name, raw)}
+	}
+	return n, nil
+}
+
+// FieldHistorian returns all values of a field.
+type FieldHistorian interface {
+	FieldHistory(ctx context.Context, uid int, fqfield string) ([]autoupdate.FieldChange, error)
+}
+
+// FieldHistory registers the route to return all values of one field.
+//
+// The field is read from the query parameter `fqfield`.
+func FieldHistory(mux *http.ServeMux, auth Authenticater, fh FieldHistorian) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		uid := auth.FromContext(r.Context())
+
+		fqfield := r.URL.Query().Get("fqfield")
+		if strings.Count(fqfield, "/") != 2 {
+			handleError(w, invalidRequestError{fmt.Errorf("Field History needs an fqfield")}, true)
+			return
+		}
+
+		changes, err := fh.FieldHistory(r.Context(), uid, fqfield)
+		if err != nil {
+			handleError(w, fmt.Errorf("getting field history: %w", err), true)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(changes); err != nil {
+			handleError(w, fmt.Errorf("encoding field history: %w", err), true)
+			return
+		}
+	})
+
+	mux.Handle(prefixPublic+"/field_history", authMiddleware(compressMiddleware(handler), auth))
+}
@@ -4,6 +4,7 @@ package http
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/keysbuilder"
@@ -26,13 +28,47 @@ const (
 // Connecter returns an connect object.
 type Connecter interface {
 	Connect(userID int, kb autoupdate.KeysBuilder) autoupdate.DataProvider
+	Resume(userID int, kb autoupdate.KeysBuilder, lastID string, listDiff bool) autoupdate.MessageProvider
+	Multiplex(userID int, kbs map[string]autoupdate.KeysBuilder, listDiff bool) autoupdate.MessageProvider
 	SingleData(ctx context.Context, userID int, kb autoupdate.KeysBuilder, position int) (map[string][]byte, error)
 }
 
 // Autoupdate builds the requested keys from the body of a request. The
 // body has to be in the format specified in the keysbuilder package.
-func Autoupdate(mux *http.ServeMux, auth Authenticater, connecter Connecter, counter *metric.CurrentCounter) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//
+// If keepalive is not zero, an empty message is sent on streaming connections,
+// when there was no message for this duration. This keeps idle connections
+// from being closed by proxies and load balancers.
+//
+// If limiter is not nil, requests are rejected, when there are too many open
+// connections.
+//
+// When the drainer drains, the streams send a reconnect message and close.
+func Autoupdate(mux *http.ServeMux, auth Authenticater, connecter Connecter, counter *metric.CurrentCounter, limiter *ConnectionLimiter, drainer *Drainer, keepalive time.Duration) {
+	handler := autoupdateHandler(auth, connecter, drainer, keepalive)
+
+	mux.Handle(
+		prefixPublic,
+		validRequest(
+			authMiddleware(
+				limitMiddleware(
+					countMiddleware(
+						compressMiddleware(handler),
+						counter,
+					),
+					limiter,
+					auth,
+				),
+				auth,
+			),
+		),
+	)
+}
+
+// autoupdateHandler is the handler for autoupdate requests. The user id is read
+// with auth.FromContext().
+func autoupdateHandler(auth Authenticater, connecter Connecter, drainer *Drainer, keepalive time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Cache-Control", "no-store, max-age=0")
 
@@ -51,6 +87,13 @@ func Autoupdate(mux *http.ServeMux, auth Authenticater, connecter Connecter, cou
 			return
 		}
 
+		if r.URL.Query().Has("multiplex") {
+			if err := sendMultiplex(w, r, uid, body, connecter, drainer, keepalive); err != nil {
+				handleError(w, err, true)
+			}
+			return
+		}
+
 		bodyBuilder, err := keysbuilder.ManyFromJSON(bytes.NewReader(body))
 		if err != nil {
 			handleError(w, fmt.Errorf("building keysbuilder from body: %w", err), true)
@@ -77,97 +120,247 @@ func Autoupdate(mux *http.ServeMux, auth Authenticater, connecter Connecter, cou
 				return
 			}
 
-			converted := make(map[string]json.RawMessage, len(data))
-			for k, v := range data {
-				converted[k] = v
-			}
-
-			if err := json.NewEncoder(w).Encode(converted); err != nil {
+			if err := writeSingle(w, r, data); err != nil {
 				handleError(w, fmt.Errorf("encoding end sending next message: %w", err), true)
-				return
 			}
 			return
 		}
 
-		if err := sendMessages(r.Context(), w, uid, builder, connecter); err != nil {
-			handleError(w, err, false)
+		lastID, resumable := resumeID(r)
+
+		// With list diffs, the messages are not a plain map anymore.
+		listDiff := r.URL.Query().Has("list_diff")
+
+		format := streamFormatFromRequest(r, resumable || listDiff)
+		w.Header().Set("Content-Type", format.contentType())
+
+		next := connecter.Resume(uid, builder, lastID, listDiff)
+		if err := sendMessages(r.Context(), w, format, next, drainer, keepalive); err != nil {
+			handleStreamError(w, format, err)
 			return
 		}
 	})
-
-	mux.Handle(
-		prefixPublic,
-		validRequest(
-			authMiddleware(
-				countMiddleware(
-					handler,
-					counter,
-				),
-				auth,
-			),
-		),
-	)
 }
 
-// HistoryInformationer is an object, that can write the history information for
-// an object.
-type HistoryInformationer interface {
-	HistoryInformation(ctx context.Context, uid int, fqid string, w io.Writer) error
+// writeSingle writes the data of a single request.
+//
+// The response has an ETag, that is created from the encoded data. If the
+// request has a matching If-None-Match header, only the status 304 is sent.
+//
+// An error is only returned, if nothing was written to w.
+func writeSingle(w http.ResponseWriter, r *http.Request, data map[string][]byte) error {
+	out := encodeData(data, nestedFromRequest(r))
+
+	var buf bytes.Buffer
+	contentType := "application/octet-stream"
+	if encoding, ok := binaryEncodingFromRequest(r); ok {
+		contentType = encoding.contentType
+		if err := encoding.encode(&buf, out); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&buf).Encode(out); err != nil {
+		return err
+	}
+
+	// The ETag is weak, since the body can be compressed.
+	hash := sha256.Sum256(buf.Bytes())
+	etag := fmt.Sprintf(`W/"%x"`, hash[:16])
+
+	// The data is for one user. So caches have to ask each time, if it is
+	// still valid.
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(buf.Bytes())
+	return nil
 }
 
-// HistoryInformation registers the route to return the history information info
-// for an fqid.
-func HistoryInformation(mux *http.ServeMux, auth Authenticater, hi HistoryInformationer) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		uid := auth.FromContext(r.Context())
+// etagMatches returns true, if the value of an If-None-Match header matches the
+// etag. The comparison is weak.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
 
-		fqid := r.URL.Query().Get("fqid")
-		if fqid == "" {
-			handleError(w, invalidRequestError{fmt.Errorf("History Information needs an fqid")}, true)
-			return
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
 		}
+	}
+	return false
+}
 
-		if err := hi.HistoryInformation(r.Context(), uid, fqid, w); err != nil {
-			handleError(w, fmt.Errorf("getting history information: %w", err), true)
-			return
+// sendMultiplex handles a request with many subscriptions.
+//
+// The body has to be a json object from the name of each subscription to a list
+// of keysbuilder bodies. The messages are always sent with an envelope that
+// contains the name of the subscription.
+//
+// An error is only returned, if nothing was written to w.
+func sendMultiplex(w http.ResponseWriter, r *http.Request, uid int, body []byte, connecter Connecter, drainer *Drainer, keepalive time.Duration) error {
+	if r.URL.Query().Has("single") || r.URL.Query().Has("position") {
+		return invalidRequestError{fmt.Errorf("multiplex can not be used with single or position")}
+	}
+
+	var subscriptions map[string]json.RawMessage
+	if err := json.Unmarshal(body, &subscriptions); err != nil {
+		return invalidRequestError{fmt.Errorf("multiplex body has to be an object from subscription names to key requests")}
+	}
+
+	if len(subscriptions) == 0 {
+		return invalidRequestError{fmt.Errorf("multiplex needs at least one subscription")}
+	}
+
+	kbs := make(map[string]autoupdate.KeysBuilder, len(subscriptions))
+	for name, rawBody := range subscriptions {
+		builder, err := keysbuilder.ManyFromJSON(bytes.NewReader(rawBody))
+		if err != nil {
+			return fmt.Errorf("building keysbuilder for subscription %s: %w", name, err)
 		}
-	})
+		kbs[name] = builder
+	}
 
-	mux.Handle(prefixPublic+"/history_information", authMiddleware(handler, auth))
+	format := streamFormatFromRequest(r, true)
+	w.Header().Set("Content-Type", format.contentType())
+
+	next := connecter.Multiplex(uid, kbs, r.URL.Query().Has("list_diff"))
+	if err := sendMessages(r.Context(), w, format, next, drainer, keepalive); err != nil {
+		handleStreamError(w, format, err)
+	}
+	return nil
 }
 
-func sendMessages(ctx context.Context, w io.Writer, uid int, kb autoupdate.KeysBuilder, connecter Connecter) error {
-	next := connecter.Connect(uid, kb)
-	encoder := json.NewEncoder(w)
+// sendMessages writes the messages from next to w.
+//
+// If heartbeat is not zero, a heartbeat is written, when there was no message
+// for this duration.
+//
+// When the drainer drains, a reconnect message is written and nil is returned.
+func sendMessages(ctx context.Context, w io.Writer, format streamFormat, next autoupdate.MessageProvider, drainer *Drainer, heartbeat time.Duration) error {
+	streamCtx, done := drainer.stream(ctx)
+	defer done()
 
-	for ctx.Err() == nil {
+	for streamCtx.Err() == nil {
 		// This blocks, until there is new data. It also unblocks, when the
-		// client context is done.
-		data, err := next(ctx)
+		// client context is done or the service shuts down.
+		msg, err := nextWithHeartbeat(streamCtx, w, format, next, heartbeat)
 		if err != nil {
+			if ctx.Err() == nil && streamCtx.Err() != nil {
+				break
+			}
 			return fmt.Errorf("getting next message: %w", err)
 		}
 
-		converted := make(map[string]json.RawMessage, len(data))
-		for k, v := range data {
-			converted[k] = v
-		}
-
-		if err := encoder.Encode(converted); err != nil {
+		if err := format.message(w, msg); err != nil {
 			return fmt.Errorf("encoding and sending next message: %w", err)
 		}
 
 		w.(http.Flusher).Flush()
 	}
-	return ctx.Err()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err := format.reconnect(w, drainer.delay()); err != nil {
+		return fmt.Errorf("sending reconnect message: %w", err)
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// nextWithHeartbeat calls next. While it is waiting for next, it writes
+// heartbeats in the given interval.
+func nextWithHeartbeat(ctx context.Context, w io.Writer, format streamFormat, next autoupdate.MessageProvider, heartbeat time.Duration) (autoupdate.Message, error) {
+	if heartbeat == 0 {
+		return next(ctx)
+	}
+
+	type nextResult struct {
+		msg autoupdate.Message
+		err error
+	}
+
+	result := make(chan nextResult, 1)
+	go func() {
+		msg, err := next(ctx)
+		result <- nextResult{msg, err}
+	}()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case res := <-result:
+			return res.msg, res.err
+
+		case <-ticker.C:
+			if err := format.heartbeat(w); err != nil {
+				return autoupdate.Message{}, fmt.Errorf("sending heartbeat: %w", err)
+			}
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+// resumeID returns the id, after which the connection should continue.
+//
+// The id is read from the header Last-Event-ID or the query parameter
+// last_event_id. The second return value is true, if the client wants
+// resumable messages.
+//
+// The id is not validated. An unknown id results in a full message.
+func resumeID(r *http.Request) (string, bool) {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("last_event_id")
+	}
+
+	if id == "" {
+		return "", r.URL.Query().Has("resumable")
+	}
+	return id, true
+}
+
+// HealthInformer returns additional values for the health route.
+type HealthInformer interface {
+	HealthInformation() map[string]any
 }
 
 // Health tells, if the service is running.
-func Health(mux *http.ServeMux) {
+//
+// The values of the informers are added to the response. They do not change
+// the healthy flag. The service can still answer requests from its cache, when
+// a backend is unavailable.
+func Health(mux *http.ServeMux, informers ...HealthInformer) {
 	url := prefixPublic + "/health"
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/octet-stream")
-		fmt.Fprintln(w, `{"healthy": true}`)
+
+		info := map[string]any{}
+		for _, informer := range informers {
+			for k, v := range informer.HealthInformation() {
+				info[k] = v
+			}
+		}
+
+		if len(info) == 0 {
+			fmt.Fprintln(w, `{"healthy": true}`)
+			return
+		}
+
+		info["healthy"] = true
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			handleError(w, fmt.Errorf("encoding health information: %w", err), false)
+		}
 	})
 
 	mux.Handle(url, handler)
@@ -185,6 +378,19 @@ func authMiddleware(next http.Handler, auth Authenticater) http.Handler {
 	})
 }
 
+// handleStreamError writes an error to a streaming response, after the body was
+// already started.
+func handleStreamError(w http.ResponseWriter, format streamFormat, err error) {
+	status, msg := errorMessage(err)
+	if status == 0 {
+		// Client closed connection.
+		return
+	}
+
+	// The error can not be handled, if the connection is already broken.
+	_ = format.error(w, msg)
+}
+
 // handleError interprets the given error and writes a corresponding message to
 // the client and/or stdout.
 //
@@ -195,26 +401,41 @@ func handleError(w http.ResponseWriter, err error, writeStatusCode bool) {
 		w.Header().Set("Content-Type", "application/octet-stream")
 	}
 
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+	status, msg := errorMessage(err)
+	if status == 0 {
 		// Client closed connection.
 		return
 	}
 
+	if writeStatusCode {
+		w.WriteHeader(status)
+	}
+
+	fmt.Fprint(w, msg)
+}
+
+// errorMessage returns the http status code and the message for the client for
+// an error. Internal errors are logged.
+//
+// If the client closed the connection, the returned status code is 0.
+func errorMessage(err error) (int, string) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, ""
+	}
+
 	var errClient ClientError
 	if errors.As(err, &errClient) {
-		if writeStatusCode {
-			w.WriteHeader(http.StatusBadRequest)
+		status := http.StatusBadRequest
+		var errStatus statusCoder
+		if errors.As(err, &errStatus) {
+			status = errStatus.StatusCode()
 		}
 
-		fmt.Fprintf(w, `{"error": {"type": "%s", "msg": "%s"}}`, errClient.Type(), quote(errClient.Error()))
-		return
+		return status, fmt.Sprintf(`{"error": {"type": "%s", "msg": "%s"}}`, errClient.Type(), quote(errClient.Error()))
 	}
 
-	if writeStatusCode {
-		w.WriteHeader(http.StatusInternalServerError)
-	}
 	log.Printf("Internal Error: %v", err)
-	fmt.Fprintln(w, `{"error": {"type": "InternalError", "msg": "Ups, something went wrong!"}}`)
+	return http.StatusInternalServerError, `{"error": {"type": "InternalError", "msg": "Ups, something went wrong!"}}` + "\n"
 }
 
 // quote decodes changes quotation marks with a backslash to make sure, they are
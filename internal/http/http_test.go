@@ -7,8 +7,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
 	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
@@ -23,6 +27,42 @@ func (c *connecterMock) Connect(userID int, kb autoupdate.KeysBuilder) autoupdat
 	return c.f
 }
 
+func (c *connecterMock) Resume(userID int, kb autoupdate.KeysBuilder, lastID string, listDiff bool) autoupdate.MessageProvider {
+	return func(ctx context.Context) (autoupdate.Message, error) {
+		data, err := c.f(ctx)
+		id, _ := strconv.Atoi(lastID)
+		return autoupdate.Message{ID: strconv.Itoa(id + 1), Full: lastID == "", Data: data}, err
+	}
+}
+
+// Multiplex returns the data from f for each subscription. The keysbuilders
+// have to be already updated.
+func (c *connecterMock) Multiplex(userID int, kbs map[string]autoupdate.KeysBuilder, listDiff bool) autoupdate.MessageProvider {
+	var pending []autoupdate.Message
+	return func(ctx context.Context) (autoupdate.Message, error) {
+		if len(pending) == 0 {
+			data, err := c.f(ctx)
+			if err != nil {
+				return autoupdate.Message{}, err
+			}
+
+			names := make([]string, 0, len(kbs))
+			for name := range kbs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				pending = append(pending, autoupdate.Message{ID: "1", Subscription: name, Data: data})
+			}
+		}
+
+		msg := pending[0]
+		pending = pending[1:]
+		return msg, nil
+	}
+}
+
 func (c *connecterMock) SingleData(ctx context.Context, userID int, kb autoupdate.KeysBuilder, position int) (map[string][]byte, error) {
 	return c.f(ctx)
 }
@@ -39,7 +79,7 @@ func TestKeysHandler(t *testing.T) {
 		},
 	}
 
-	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil)
+	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
 
 	req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name,user/2/name", nil).WithContext(ctx)
 	rec := httptest.NewRecorder()
@@ -70,7 +110,7 @@ func TestComplexHandler(t *testing.T) {
 		},
 	}
 
-	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil)
+	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
 
 	req := httptest.NewRequest(
 		"GET",
@@ -93,6 +133,333 @@ func TestComplexHandler(t *testing.T) {
 	}
 }
 
+func TestResumableHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		url    string
+		header string
+		expect string
+	}{
+		{
+			"resumable",
+			"/system/autoupdate?k=user/1/name&resumable=1",
+			"",
+			`{"id":"1","full":true,"data":{"foo":"bar"}}` + "\n",
+		},
+		{
+			"Last-Event-ID",
+			"/system/autoupdate?k=user/1/name",
+			"41",
+			`{"id":"42","data":{"foo":"bar"}}` + "\n",
+		},
+		{
+			"last_event_id",
+			"/system/autoupdate?k=user/1/name&last_event_id=41",
+			"",
+			`{"id":"42","data":{"foo":"bar"}}` + "\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					cancel()
+					return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+				},
+			}
+
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+			req := httptest.NewRequest("GET", tt.url, nil).WithContext(ctx)
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			got, _ := io.ReadAll(rec.Result().Body)
+			if string(got) != tt.expect {
+				t.Errorf("Got content %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestNestedHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		url    string
+		expect string
+	}{
+		{
+			"single",
+			"/system/autoupdate?k=user/1/name,user/1/age,user/2/name&nested=1&single=1",
+			`{"user":{"1":{"age":42,"name":"foo"},"2":{"name":null}}}` + "\n",
+		},
+		{
+			"streaming",
+			"/system/autoupdate?k=user/1/name,user/1/age,user/2/name&nested=1",
+			`{"user":{"1":{"age":42,"name":"foo"},"2":{"name":null}}}` + "\n",
+		},
+		{
+			"resumable",
+			"/system/autoupdate?k=user/1/name,user/1/age,user/2/name&nested=1&resumable=1",
+			`{"id":"1","full":true,"data":{"user":{"1":{"age":42,"name":"foo"},"2":{"name":null}}}}` + "\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					cancel()
+					return map[string][]byte{
+						"user/1/name": []byte(`"foo"`),
+						"user/1/age":  []byte(`42`),
+						"user/2/name": nil,
+					}, nil
+				},
+			}
+
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+			req := httptest.NewRequest("GET", tt.url, nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			got, _ := io.ReadAll(rec.Result().Body)
+			if string(got) != tt.expect {
+				t.Errorf("Got content %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestMultiplexHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		url    string
+		body   string
+		expect string
+	}{
+		{
+			"two subscriptions",
+			"/system/autoupdate?multiplex=1",
+			`{"projector": [{"ids": [1], "collection": "projector", "fields": {"name": null}}], "agenda": [{"ids": [1], "collection": "agenda_item", "fields": {"name": null}}]}`,
+			`{"id":"1","subscription":"agenda","data":{"foo":"bar"}}` + "\n" +
+				`{"id":"1","subscription":"projector","data":{"foo":"bar"}}` + "\n",
+		},
+		{
+			"invalid body",
+			"/system/autoupdate?multiplex=1",
+			`[{"ids": [1], "collection": "projector", "fields": {"name": null}}]`,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: multiplex body has to be an object from subscription names to key requests"}}`,
+		},
+		{
+			"single",
+			"/system/autoupdate?multiplex=1&single=1",
+			`{"projector": [{"ids": [1], "collection": "projector", "fields": {"name": null}}]}`,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: multiplex can not be used with single or position"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+				},
+			}
+
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+			req := httptest.NewRequest("POST", tt.url, strings.NewReader(tt.body)).WithContext(ctx)
+			rec := &cancelAfterWrites{ResponseRecorder: httptest.NewRecorder(), writes: 2, cancel: cancel}
+			mux.ServeHTTP(rec, req)
+
+			got, _ := io.ReadAll(rec.Result().Body)
+			if string(got) != tt.expect {
+				t.Errorf("Got content %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+// cancelAfterWrites is a ResponseRecorder that calls cancel after the given
+// amount of writes.
+type cancelAfterWrites struct {
+	*httptest.ResponseRecorder
+	writes int
+	cancel func()
+}
+
+func (w *cancelAfterWrites) Write(p []byte) (int, error) {
+	w.writes--
+	if w.writes == 0 {
+		w.cancel()
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+// listDiffConnecter returns a message with a list diff, if the client asked for
+// it.
+type listDiffConnecter struct {
+	connecterMock
+}
+
+func (c *listDiffConnecter) Resume(userID int, kb autoupdate.KeysBuilder, lastID string, listDiff bool) autoupdate.MessageProvider {
+	return func(ctx context.Context) (autoupdate.Message, error) {
+		if _, err := c.f(ctx); err != nil {
+			return autoupdate.Message{}, err
+		}
+
+		if !listDiff {
+			return autoupdate.Message{ID: "2", Data: map[string][]byte{"meeting/1/user_ids": []byte("[1,2,3]")}}, nil
+		}
+
+		return autoupdate.Message{
+			ID:       "2",
+			ListDiff: map[string]autoupdate.ListDiff{"meeting/1/user_ids": {Add: []json.RawMessage{[]byte("3")}}},
+		}, nil
+	}
+}
+
+func TestListDiffHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		url    string
+		expect string
+	}{
+		{
+			"without list_diff",
+			"/system/autoupdate?k=meeting/1/user_ids",
+			`{"meeting/1/user_ids":[1,2,3]}` + "\n",
+		},
+		{
+			"with list_diff",
+			"/system/autoupdate?k=meeting/1/user_ids&list_diff=1",
+			`{"id":"2","data":{},"list_diff":{"meeting/1/user_ids":{"add":[3]}}}` + "\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mux := http.NewServeMux()
+			connecter := &listDiffConnecter{connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					cancel()
+					return nil, nil
+				},
+			}}
+
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+			req := httptest.NewRequest("GET", tt.url, nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			got, _ := io.ReadAll(rec.Result().Body)
+			if string(got) != tt.expect {
+				t.Errorf("Got content %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestEventStreamHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		url    string
+		accept string
+	}{
+		{"Accept header", "/system/autoupdate?k=user/1/name", "text/event-stream"},
+		{"query parameter", "/system/autoupdate?k=user/1/name&sse=1", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					cancel()
+					return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+				},
+			}
+
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+			req := httptest.NewRequest("GET", tt.url, nil).WithContext(ctx)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if got := rec.Result().Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("Got content type %q, expected text/event-stream", got)
+			}
+
+			expect := "id: 1\ndata: {\"id\":\"1\",\"full\":true,\"data\":{\"foo\":\"bar\"}}\n\n"
+			got, _ := io.ReadAll(rec.Result().Body)
+			if string(got) != expect {
+				t.Errorf("Got content %q, expected %q", got, expect)
+			}
+		})
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		url    string
+		expect string
+	}{
+		{"json", "/system/autoupdate?k=user/1/name", "{}\n"},
+		{"json with envelope", "/system/autoupdate?k=user/1/name&list_diff=1", `{"heartbeat":true}` + "\n"},
+		{"event stream", "/system/autoupdate?k=user/1/name&sse=1", ":\n\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				},
+			}
+
+			ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, time.Millisecond)
+
+			req := httptest.NewRequest("GET", tt.url, nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			done := make(chan struct{})
+			go func() {
+				mux.ServeHTTP(rec, req)
+				close(done)
+			}()
+
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+			<-done
+
+			got, _ := io.ReadAll(rec.Result().Body)
+			if !strings.HasPrefix(string(got), tt.expect+tt.expect) {
+				t.Errorf("Got content %q, expected repeated %q", got, tt.expect)
+			}
+		})
+	}
+}
+
 func TestHealth(t *testing.T) {
 	mux := http.NewServeMux()
 	ahttp.Health(mux)
@@ -119,7 +486,7 @@ func TestErrors(t *testing.T) {
 			return map[string][]byte{"foo": []byte(`"bar"`)}, nil
 		},
 	}
-	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil)
+	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
 
 	for _, tt := range []struct {
 		name    string
@@ -218,29 +585,31 @@ func TestErrors(t *testing.T) {
 
 type HistoryInformationStub struct {
 	uid   int
-	fqid  string
-	write string
+	query autoupdate.HistoryQuery
+	page  autoupdate.HistoryPage
 	err   error
 }
 
-func (h *HistoryInformationStub) HistoryInformation(ctx context.Context, uid int, fqid string, w io.Writer) error {
+func (h *HistoryInformationStub) HistoryInformation(ctx context.Context, uid int, query autoupdate.HistoryQuery) (autoupdate.HistoryPage, error) {
 	h.uid = uid
-	h.fqid = fqid
-	if h.write != "" {
-		w.Write([]byte(h.write))
-	}
-	return h.err
+	h.query = query
+	return h.page, h.err
 }
 
 func TestHistoryInformation(t *testing.T) {
 	mux := http.NewServeMux()
 	hi := &HistoryInformationStub{
-		write: "my information",
+		page: autoupdate.HistoryPage{
+			Total: 3,
+			Entries: []autoupdate.HistoryEntry{
+				{FQID: "motion/42", Position: 23, Timestamp: 15, UserID: 5, Information: []byte(`["motion was created"]`)},
+			},
+		},
 	}
 	ahttp.HistoryInformation(mux, test.Auth(1), hi)
 
 	resp := httptest.NewRecorder()
-	req := httptest.NewRequest("GET", "/system/autoupdate/history_information?fqid=motion/42", nil)
+	req := httptest.NewRequest("GET", "/system/autoupdate/history_information?fqid=motion/42,motion/43&fqid=topic/1&user_id=5&since=10&until=20&offset=1&limit=2", nil)
 
 	mux.ServeHTTP(resp, req)
 
@@ -248,24 +617,51 @@ func TestHistoryInformation(t *testing.T) {
 		t.Errorf("got status %s, expected %s", resp.Result().Status, http.StatusText(http.StatusOK))
 	}
 
-	if body, _ := io.ReadAll(resp.Result().Body); string(body) != "my information" {
-		t.Errorf("got body %s, expected `my information`", body)
+	expect := `{"total":3,"entries":[{"fqid":"motion/42","position":23,"timestamp":15,"user_id":5,"information":["motion was created"]}]}` + "\n"
+	if body, _ := io.ReadAll(resp.Result().Body); string(body) != expect {
+		t.Errorf("got body %s, expected %s", body, expect)
 	}
 
 	if hi.uid != 1 {
 		t.Errorf("hi was called with user %d, expected 1", hi.uid)
 	}
 
-	if hi.fqid != "motion/42" {
-		t.Errorf("hi was called with `%s`, expected `motion/42`", hi.fqid)
+	expectQuery := autoupdate.HistoryQuery{
+		FQIDs:  []string{"motion/42", "motion/43", "topic/1"},
+		UserID: 5,
+		Since:  10,
+		Until:  20,
+		Offset: 1,
+		Limit:  2,
+	}
+	if !reflect.DeepEqual(hi.query, expectQuery) {
+		t.Errorf("hi was called with %v, expected %v", hi.query, expectQuery)
 	}
 }
 
-func TestHistoryInformationNoFQID(t *testing.T) {
+func TestHistoryInformationInvalidParameter(t *testing.T) {
 	mux := http.NewServeMux()
-	hi := &HistoryInformationStub{
-		write: "my information",
+	hi := &HistoryInformationStub{}
+	ahttp.HistoryInformation(mux, test.Auth(1), hi)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/system/autoupdate/history_information?fqid=motion/42&limit=-1", nil)
+
+	mux.ServeHTTP(resp, req)
+
+	if resp.Result().StatusCode != 400 {
+		t.Errorf("got status %s, expected %s", resp.Result().Status, http.StatusText(http.StatusBadRequest))
+	}
+
+	expect := `{"error": {"type": "invalid_request", "msg": "Invalid request: limit has to be a positive number, not -1"}}`
+	if body, _ := io.ReadAll(resp.Result().Body); string(body) != expect {
+		t.Errorf("got body `%s`, expected `%s`", body, expect)
 	}
+}
+
+func TestHistoryInformationNoFQID(t *testing.T) {
+	mux := http.NewServeMux()
+	hi := &HistoryInformationStub{}
 	ahttp.HistoryInformation(mux, test.Auth(1), hi)
 
 	resp := httptest.NewRecorder()
@@ -304,3 +700,164 @@ func TestHistoryInformationError(t *testing.T) {
 		t.Errorf("got body `%s`, expected `%s`", body, expect)
 	}
 }
+
+type fieldHistoryStub struct {
+	fqfield string
+}
+
+func (f *fieldHistoryStub) FieldHistory(ctx context.Context, uid int, fqfield string) ([]autoupdate.FieldChange, error) {
+	f.fqfield = fqfield
+	return []autoupdate.FieldChange{
+		{Position: 1, Timestamp: 100, UserID: 5, Value: []byte(`"first"`)},
+		{Position: 3, Timestamp: 300, UserID: 6},
+	}, nil
+}
+
+func TestFieldHistory(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		url          string
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			"valid",
+			"/system/autoupdate/field_history?fqfield=motion/42/title",
+			200,
+			`[{"position":1,"timestamp":100,"user_id":5,"value":"first"},{"position":3,"timestamp":300,"user_id":6,"value":null}]` + "\n",
+		},
+		{
+			"no fqfield",
+			"/system/autoupdate/field_history?fqfield=motion/42",
+			400,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: Field History needs an fqfield"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			fh := &fieldHistoryStub{}
+			ahttp.FieldHistory(mux, test.Auth(1), fh)
+
+			resp := httptest.NewRecorder()
+			mux.ServeHTTP(resp, httptest.NewRequest("GET", tt.url, nil))
+
+			if resp.Code != tt.expectStatus {
+				t.Errorf("got status %d, expected %d", resp.Code, tt.expectStatus)
+			}
+
+			if body, _ := io.ReadAll(resp.Result().Body); string(body) != tt.expectBody {
+				t.Errorf("got body `%s`, expected `%s`", body, tt.expectBody)
+			}
+		})
+	}
+}
+
+func TestSingleETag(t *testing.T) {
+	mux := http.NewServeMux()
+	connecter := &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			return map[string][]byte{"user/1/name": []byte(`"foo"`), "user/2/name": []byte(`"bar"`)}, nil
+		},
+	}
+	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, nil, nil, 0)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name,user/2/name&single=1", nil))
+
+	etag := rec.Result().Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("Response has no ETag")
+	}
+
+	t.Run("same etag", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name,user/2/name&single=1", nil)
+		mux.ServeHTTP(rec, req)
+
+		if got := rec.Result().Header.Get("ETag"); got != etag {
+			t.Errorf("Got ETag %q on second request, expected %q", got, etag)
+		}
+	})
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name,user/2/name&single=1", nil)
+		req.Header.Set("If-None-Match", etag)
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("Got status %d, expected 304", rec.Code)
+		}
+
+		if rec.Body.Len() != 0 {
+			t.Errorf("Got body %q, expected no body", rec.Body.String())
+		}
+	})
+
+	t.Run("If-None-Match with compression", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name,user/2/name&single=1", nil)
+		req.Header.Set("If-None-Match", etag)
+		req.Header.Set("Accept-Encoding", "gzip")
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("Got status %d, expected 304", rec.Code)
+		}
+
+		if rec.Body.Len() != 0 {
+			t.Errorf("Got body %q, expected no body", rec.Body.String())
+		}
+
+		if got := rec.Result().Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("Got Content-Encoding %q, expected none", got)
+		}
+	})
+
+	t.Run("other If-None-Match", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name,user/2/name&single=1", nil)
+		req.Header.Set("If-None-Match", `W/"other"`)
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got status %d, expected 200", rec.Code)
+		}
+	})
+
+	t.Run("other encoding", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name,user/2/name&single=1&nested=1", nil)
+		req.Header.Set("If-None-Match", etag)
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got status %d, expected 200", rec.Code)
+		}
+	})
+}
+
+type healthInformerStub map[string]any
+
+func (h healthInformerStub) HealthInformation() map[string]any {
+	return h
+}
+
+func TestHealthInformation(t *testing.T) {
+	mux := http.NewServeMux()
+	ahttp.Health(mux, healthInformerStub{"datastore_reader": "open"})
+
+	req := httptest.NewRequest("", "/system/autoupdate/health", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var got map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+
+	expect := map[string]any{"healthy": true, "datastore_reader": "open"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got %v, expected %v", got, expect)
+	}
+}
@@ -16,3 +16,9 @@ type ClientError interface {
 	Type() string
 	Error() string
 }
+
+// statusCoder is a ClientError, that is returned with another http status code
+// then 400.
+type statusCoder interface {
+	StatusCode() int
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+)
+
+// unrestrictedUserID is the user id of internal requests, that read
+// unrestricted data. It is only used inside this file.
+const unrestrictedUserID = -1
+
+// InternalAutoupdate registers the autoupdate route for other services.
+//
+// It works like the Autoupdate route, but the request has to be authenticated
+// with the header `Authorization: Bearer <secret>`. The query parameter
+// `user_id` tells, as which user the data is restricted. With the query
+// parameter `unrestricted`, the data is read from the unrestricted connecter.
+func InternalAutoupdate(mux *http.ServeMux, secret string, connecter Connecter, unrestricted Connecter, drainer *Drainer, keepalive time.Duration) {
+	auth := internalAuth{secret: []byte(secret)}
+	c := internalConnecter{
+		restricted:   connecter,
+		unrestricted: unrestricted,
+	}
+
+	handler := autoupdateHandler(auth, c, drainer, keepalive)
+
+	mux.Handle(
+		prefixInternal,
+		validRequest(
+			authMiddleware(
+				compressMiddleware(handler),
+				auth,
+			),
+		),
+	)
+}
+
+type internalUserIDKey struct{}
+
+// internalAuth authenticates requests from other services with a shared
+// secret.
+type internalAuth struct {
+	secret []byte
+}
+
+// Authenticate checks the secret and reads the user id from the request.
+func (a internalAuth) Authenticate(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, internalAuthError{}
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	if len(a.secret) == 0 || subtle.ConstantTimeCompare([]byte(token), a.secret) != 1 {
+		return nil, internalAuthError{}
+	}
+
+	query := r.URL.Query()
+	if query.Has("unrestricted") {
+		return context.WithValue(r.Context(), internalUserIDKey{}, unrestrictedUserID), nil
+	}
+
+	rawUserID := query.Get("user_id")
+	if rawUserID == "" {
+		return nil, invalidRequestError{fmt.Errorf("internal requests need the query parameter user_id or unrestricted")}
+	}
+
+	uid, err := strconv.Atoi(rawUserID)
+	if err != nil || uid < 0 {
+		return nil, invalidRequestError{fmt.Errorf("user_id has to be a positive number, not %s", rawUserID)}
+	}
+
+	return context.WithValue(r.Context(), internalUserIDKey{}, uid), nil
+}
+
+// FromContext returns the user id from the context.
+func (a internalAuth) FromContext(ctx context.Context) int {
+	v, _ := ctx.Value(internalUserIDKey{}).(int)
+	return v
+}
+
+// internalConnecter uses the unrestricted connecter, if the user id is
+// unrestrictedUserID.
+type internalConnecter struct {
+	restricted   Connecter
+	unrestricted Connecter
+}
+
+func (c internalConnecter) get(userID int) (Connecter, int) {
+	if userID == unrestrictedUserID {
+		return c.unrestricted, 0
+	}
+	return c.restricted, userID
+}
+
+func (c internalConnecter) Connect(userID int, kb autoupdate.KeysBuilder) autoupdate.DataProvider {
+	connecter, userID := c.get(userID)
+	return connecter.Connect(userID, kb)
+}
+
+func (c internalConnecter) Resume(userID int, kb autoupdate.KeysBuilder, lastID string, listDiff bool) autoupdate.MessageProvider {
+	connecter, userID := c.get(userID)
+	return connecter.Resume(userID, kb, lastID, listDiff)
+}
+
+func (c internalConnecter) Multiplex(userID int, kbs map[string]autoupdate.KeysBuilder, listDiff bool) autoupdate.MessageProvider {
+	connecter, userID := c.get(userID)
+	return connecter.Multiplex(userID, kbs, listDiff)
+}
+
+func (c internalConnecter) SingleData(ctx context.Context, userID int, kb autoupdate.KeysBuilder, position int) (map[string][]byte, error) {
+	connecter, userID := c.get(userID)
+	return connecter.SingleData(ctx, userID, kb, position)
+}
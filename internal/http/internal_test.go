@@ -0,0 +1,104 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
+)
+
+// userIDConnecter returns its name and the user id, it was called with.
+type userIDConnecter struct {
+	connecterMock
+	name string
+}
+
+func (c *userIDConnecter) SingleData(ctx context.Context, userID int, kb autoupdate.KeysBuilder, position int) (map[string][]byte, error) {
+	return map[string][]byte{c.name: []byte{byte('0' + userID)}}, nil
+}
+
+func TestInternalAutoupdate(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		url          string
+		token        string
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			"as user",
+			"/internal/autoupdate?k=user/1/name&single=1&user_id=5",
+			"Bearer my secret",
+			200,
+			`{"restricted":5}` + "\n",
+		},
+		{
+			"unrestricted",
+			"/internal/autoupdate?k=user/1/name&single=1&unrestricted=1",
+			"Bearer my secret",
+			200,
+			`{"unrestricted":0}` + "\n",
+		},
+		{
+			"no user id",
+			"/internal/autoupdate?k=user/1/name&single=1",
+			"Bearer my secret",
+			400,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: internal requests need the query parameter user_id or unrestricted"}}`,
+		},
+		{
+			"invalid user id",
+			"/internal/autoupdate?k=user/1/name&single=1&user_id=abc",
+			"Bearer my secret",
+			400,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: user_id has to be a positive number, not abc"}}`,
+		},
+		{
+			"wrong secret",
+			"/internal/autoupdate?k=user/1/name&single=1&user_id=5",
+			"Bearer other secret",
+			401,
+			`{"error": {"type": "auth", "msg": "invalid or missing service secret"}}`,
+		},
+		{
+			"secret without bearer",
+			"/internal/autoupdate?k=user/1/name&single=1&user_id=5",
+			"my secret",
+			401,
+			`{"error": {"type": "auth", "msg": "invalid or missing service secret"}}`,
+		},
+		{
+			"no secret",
+			"/internal/autoupdate?k=user/1/name&single=1&user_id=5",
+			"",
+			401,
+			`{"error": {"type": "auth", "msg": "invalid or missing service secret"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			restricted := &userIDConnecter{name: "restricted"}
+			unrestricted := &userIDConnecter{name: "unrestricted"}
+			ahttp.InternalAutoupdate(mux, "my secret", restricted, unrestricted, nil, 0)
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectStatus {
+				t.Errorf("Got status %d, expected %d", rec.Code, tt.expectStatus)
+			}
+
+			if got, _ := io.ReadAll(rec.Result().Body); string(got) != tt.expectBody {
+				t.Errorf("Got body %q, expected %q", got, tt.expectBody)
+			}
+		})
+	}
+}
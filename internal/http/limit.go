@@ -0,0 +1,167 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/metric"
+)
+
+// ConnectionLimiter limits the amount of open connections per user, per ip
+// address of anonymous users and in total.
+//
+// It has to be created with NewConnectionLimiter().
+type ConnectionLimiter struct {
+	perUser        int
+	perIP          int
+	global         int
+	trustedProxies []*net.IPNet
+
+	mu       sync.Mutex
+	users    map[int]int
+	ips      map[string]int
+	total    int
+	rejected uint64
+}
+
+// NewConnectionLimiter initializes a ConnectionLimiter. A limit of 0 means, that
+// there is no limit.
+//
+// The header X-Forwarded-For is only used, if the request comes from one of
+// the trustedProxies. Otherwise the address of the connection is used.
+func NewConnectionLimiter(perUser, perIP, global int, trustedProxies []*net.IPNet) *ConnectionLimiter {
+	return &ConnectionLimiter{
+		perUser:        perUser,
+		perIP:          perIP,
+		global:         global,
+		trustedProxies: trustedProxies,
+		users:          make(map[int]int),
+		ips:            make(map[string]int),
+	}
+}
+
+// acquire registers a new connection. If a limit is reached, a
+// tooManyConnectionsError is returned. Otherwise, release has to be called
+// after the connection is closed.
+//
+// For anonymous users (uid 0), the connections are counted per ip address.
+func (l *ConnectionLimiter) acquire(uid int, ip string) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.global > 0 && l.total >= l.global {
+		l.rejected++
+		return nil, tooManyConnectionsError{"the server has too many open connections"}
+	}
+
+	if uid != 0 {
+		if l.perUser > 0 && l.users[uid] >= l.perUser {
+			l.rejected++
+			return nil, tooManyConnectionsError{fmt.Sprintf("user %d has too many open connections", uid)}
+		}
+
+		l.users[uid]++
+		l.total++
+		return func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.total--
+			l.users[uid]--
+			if l.users[uid] == 0 {
+				delete(l.users, uid)
+			}
+		}, nil
+	}
+
+	if l.perIP > 0 && l.ips[ip] >= l.perIP {
+		l.rejected++
+		return nil, tooManyConnectionsError{"too many open connections from your ip address"}
+	}
+
+	l.ips[ip]++
+	l.total++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.total--
+		l.ips[ip]--
+		if l.ips[ip] == 0 {
+			delete(l.ips, ip)
+		}
+	}, nil
+}
+
+// Metric writes the current connections and the rejected connections.
+func (l *ConnectionLimiter) Metric(con metric.Container) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := con.Sub("connection_limit")
+	s.Add("current", l.total)
+	s.Add("users", len(l.users))
+	s.Add("anonymous_ips", len(l.ips))
+	s.Add("rejected", l.rejected)
+}
+
+func limitMiddleware(next http.Handler, limiter *ConnectionLimiter, auth Authenticater) http.Handler {
+	if limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := limiter.acquire(auth.FromContext(r.Context()), clientIP(r, limiter.trustedProxies))
+		if err != nil {
+			handleError(w, err, true)
+			return
+		}
+		defer release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the ip address of the client.
+//
+// The header X-Forwarded-For can be set by the client. So it is only used, if
+// the request comes from a trusted proxy. In this case, the last address in
+// the header, that is not a trusted proxy, is used.
+func clientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" || !trusted(host, trustedProxies) {
+		return host
+	}
+
+	addresses := strings.Split(forwarded, ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		host = strings.TrimSpace(addresses[i])
+		if !trusted(host, trustedProxies) {
+			break
+		}
+	}
+	return host
+}
+
+// trusted returns true, if the address is in one of the networks.
+func trusted(address string, networks []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
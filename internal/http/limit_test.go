@@ -0,0 +1,194 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		limiter    *ahttp.ConnectionLimiter
+		uid        int
+		firstIP    string
+		secondIP   string
+		expectCode int
+		expectBody string
+	}{
+		{
+			"per user",
+			ahttp.NewConnectionLimiter(1, 0, 0, nil),
+			1,
+			"1.1.1.1:1000",
+			"2.2.2.2:1000",
+			429,
+			`{"error": {"type": "too_many_connections", "msg": "user 1 has too many open connections"}}`,
+		},
+		{
+			"per ip same ip",
+			ahttp.NewConnectionLimiter(0, 1, 0, nil),
+			0,
+			"1.1.1.1:1000",
+			"1.1.1.1:2000",
+			429,
+			`{"error": {"type": "too_many_connections", "msg": "too many open connections from your ip address"}}`,
+		},
+		{
+			"per ip other ip",
+			ahttp.NewConnectionLimiter(0, 1, 0, nil),
+			0,
+			"1.1.1.1:1000",
+			"2.2.2.2:1000",
+			200,
+			`{"foo":"bar"}` + "\n",
+		},
+		{
+			"per ip does not limit users",
+			ahttp.NewConnectionLimiter(0, 1, 0, nil),
+			1,
+			"1.1.1.1:1000",
+			"1.1.1.1:2000",
+			200,
+			`{"foo":"bar"}` + "\n",
+		},
+		{
+			"global",
+			ahttp.NewConnectionLimiter(0, 0, 1, nil),
+			0,
+			"1.1.1.1:1000",
+			"2.2.2.2:1000",
+			429,
+			`{"error": {"type": "too_many_connections", "msg": "the server has too many open connections"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			firstStarted := make(chan struct{})
+			releaseFirst := make(chan struct{})
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					if ctx.Value(firstKey{}) != nil {
+						close(firstStarted)
+						<-releaseFirst
+					}
+					return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+				},
+			}
+			ahttp.Autoupdate(mux, test.Auth(tt.uid), connecter, nil, tt.limiter, nil, 0)
+
+			firstDone := make(chan struct{})
+			go func() {
+				defer close(firstDone)
+				ctx := context.WithValue(context.Background(), firstKey{}, true)
+				req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name&single=1", nil).WithContext(ctx)
+				req.RemoteAddr = tt.firstIP
+				mux.ServeHTTP(httptest.NewRecorder(), req)
+			}()
+			<-firstStarted
+
+			req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name&single=1", nil)
+			req.RemoteAddr = tt.secondIP
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			close(releaseFirst)
+			<-firstDone
+
+			if rec.Code != tt.expectCode {
+				t.Errorf("Got status %d, expected %d", rec.Code, tt.expectCode)
+			}
+
+			if got, _ := io.ReadAll(rec.Result().Body); string(got) != tt.expectBody {
+				t.Errorf("Got body %q, expected %q", got, tt.expectBody)
+			}
+		})
+	}
+}
+
+func TestConnectionLimitReleased(t *testing.T) {
+	mux := http.NewServeMux()
+	connecter := &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+		},
+	}
+	ahttp.Autoupdate(mux, test.Auth(1), connecter, nil, ahttp.NewConnectionLimiter(1, 1, 1, nil), nil, 0)
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name&single=1", nil))
+
+		if rec.Code != 200 {
+			t.Errorf("Request %d got status %d, expected 200", i, rec.Code)
+		}
+	}
+}
+
+func TestConnectionLimitForwardedFor(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for _, tt := range []struct {
+		name       string
+		remoteAddr string
+		firstIP    string
+		secondIP   string
+		expectCode int
+	}{
+		{"untrusted proxy", "1.1.1.1:1000", "2.2.2.2", "3.3.3.3", 429},
+		{"trusted proxy other ip", "10.0.0.1:1000", "2.2.2.2", "3.3.3.3", 200},
+		{"trusted proxy same ip", "10.0.0.1:1000", "2.2.2.2", "2.2.2.2", 429},
+		{"trusted proxy spoofed header", "10.0.0.1:1000", "4.4.4.4, 2.2.2.2", "5.5.5.5, 2.2.2.2", 429},
+		{"two trusted proxies", "10.0.0.1:1000", "2.2.2.2, 10.0.0.2", "3.3.3.3, 10.0.0.2", 200},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			firstStarted := make(chan struct{})
+			releaseFirst := make(chan struct{})
+
+			mux := http.NewServeMux()
+			connecter := &connecterMock{
+				func(ctx context.Context) (map[string][]byte, error) {
+					if ctx.Value(firstKey{}) != nil {
+						close(firstStarted)
+						<-releaseFirst
+					}
+					return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+				},
+			}
+			ahttp.Autoupdate(mux, test.Auth(0), connecter, nil, ahttp.NewConnectionLimiter(0, 1, 0, []*net.IPNet{proxies}), nil, 0)
+
+			firstDone := make(chan struct{})
+			go func() {
+				defer close(firstDone)
+				ctx := context.WithValue(context.Background(), firstKey{}, true)
+				req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name&single=1", nil).WithContext(ctx)
+				req.RemoteAddr = tt.remoteAddr
+				req.Header.Set("X-Forwarded-For", tt.firstIP)
+				mux.ServeHTTP(httptest.NewRecorder(), req)
+			}()
+			<-firstStarted
+
+			req := httptest.NewRequest("GET", "/system/autoupdate?k=user/1/name&single=1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.secondIP)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			close(releaseFirst)
+			<-firstDone
+
+			if rec.Code != tt.expectCode {
+				t.Errorf("Got status %d, expected %d", rec.Code, tt.expectCode)
+			}
+		})
+	}
+}
+
+type firstKey struct{}
@@ -0,0 +1,306 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/keysbuilder"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/metric"
+	"golang.org/x/net/websocket"
+)
+
+// Websocket registers the websocket route of the autoupdate service.
+//
+// It works like the Autoupdate route, but the data is sent as websocket
+// frames. Each message is one text frame that contains the json object. Since
+// browsers can not send a body with a websocket request, the initial keys are
+// read from the query parameter `k`. Afterwards, the client can add or remove
+// keysbuilder bodies with control messages.
+//
+// When the drainer drains, a reconnect message is sent and the connection is
+// closed.
+//
+// Browsers can not set the auth header on a websocket request. So the token
+// can also be given with the query parameter `authentication`. A renewed token
+// is sent as the first message.
+//
+// Requests with an Origin header are only accepted, if the origin is the host
+// of the request or one of allowedOrigins. This prevents other websites from
+// using the cookie of a logged in user.
+func Websocket(mux *http.ServeMux, auth Authenticater, connecter Connecter, counter *metric.CurrentCounter, limiter *ConnectionLimiter, drainer *Drainer, allowedOrigins []string) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid := auth.FromContext(r.Context())
+
+		// The response headers are not sent on a websocket connection. So a
+		// renewed token has to be read before the handshake.
+		newToken := w.Header().Get(authHeader)
+
+		builder, err := keysbuilder.FromKeys(strings.Split(r.URL.Query().Get("k"), ","))
+		if err != nil {
+			handleError(w, fmt.Errorf("building keysbuilder from query: %w", err), true)
+			return
+		}
+
+		server := websocket.Server{
+			Handshake: func(_ *websocket.Config, r *http.Request) error {
+				return checkOrigin(r, allowedOrigins)
+			},
+			Handler: func(conn *websocket.Conn) {
+				defer conn.Close()
+
+				if newToken != "" {
+					if err := websocket.JSON.Send(conn, tokenMessage{newToken}); err != nil {
+						return
+					}
+				}
+
+				if err := sendWebsocketMessages(r.Context(), conn, uid, builder, connecter, drainer); err != nil {
+					handleWebsocketError(conn, err)
+				}
+			},
+		}
+		server.ServeHTTP(w, r)
+	})
+
+	mux.Handle(
+		prefixPublic+"/websocket",
+		validRequest(
+			websocketTokenMiddleware(
+				authMiddleware(
+					limitMiddleware(
+						countMiddleware(
+							handler,
+							counter,
+						),
+						limiter,
+						auth,
+					),
+					auth,
+				),
+			),
+		),
+	)
+}
+
+const authHeader = "Authentication"
+
+// websocketTokenMiddleware sets the auth header from the query parameter
+// `authentication`, if the request has no auth header.
+func websocketTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("authentication")
+		if token != "" && r.Header.Get(authHeader) == "" {
+			if !strings.HasPrefix(token, "bearer ") {
+				token = "bearer " + token
+			}
+			r.Header.Set(authHeader, token)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin returns an error, if the request was sent from a website, that
+// is not allowed to connect.
+//
+// Requests without an Origin header are not sent by browsers and therefore
+// allowed.
+func checkOrigin(r *http.Request, allowedOrigins []string) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %s: %w", origin, err)
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+
+	for _, allowed := range allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+// tokenMessage sends a renewed auth token to the client.
+type tokenMessage struct {
+	Token string `json:"token"`
+}
+
+// sendWebsocketMessages sends the data from the connecter as websocket frames.
+//
+// It also reads the frames from the client. This is necessary to answer ping
+// frames, to notice, when the client closes the connection and to receive
+// control messages, that change the requested keys.
+func sendWebsocketMessages(ctx context.Context, conn *websocket.Conn, uid int, kb *keysbuilder.Builder, connecter Connecter, drainer *Drainer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	streamCtx, done := drainer.stream(ctx)
+	defer done()
+
+	controls := make(chan controlMessage)
+	go func() {
+		// Cancel the context when the client closes the connection. If
+		// reading fails for another reason, the connection is broken and there
+		// is nobody to tell.
+		defer cancel()
+		readWebsocketFrames(ctx, conn, controls)
+	}()
+
+	next := connecter.Connect(uid, kb)
+
+	type nextResult struct {
+		data map[string][]byte
+		err  error
+	}
+
+	for streamCtx.Err() == nil {
+		nextCtx, cancelNext := context.WithCancel(streamCtx)
+		result := make(chan nextResult, 1)
+		go func() {
+			// This blocks, until there is new data. It also unblocks, when the
+			// client context is done.
+			data, err := next(nextCtx)
+			result <- nextResult{data, err}
+		}()
+
+		var res nextResult
+		var control *controlMessage
+		select {
+		case res = <-result:
+		case c := <-controls:
+			control = &c
+
+			// Stop the DataProvider before the keysbuilder is changed. If it
+			// already created data, it is sent before the change.
+			cancelNext()
+			res = <-result
+			if errors.Is(res.err, context.Canceled) && streamCtx.Err() == nil {
+				res.err = nil
+			}
+		}
+		cancelNext()
+
+		if res.err != nil {
+			if ctx.Err() == nil && streamCtx.Err() != nil {
+				break
+			}
+			return fmt.Errorf("getting next message: %w", res.err)
+		}
+
+		if len(res.data) > 0 {
+			if err := websocket.JSON.Send(conn, convertData(res.data)); err != nil {
+				return fmt.Errorf("sending next message: %w", err)
+			}
+		}
+
+		if control != nil {
+			if err := control.apply(kb); err != nil {
+				handleWebsocketError(conn, err)
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err := websocket.JSON.Send(conn, newReconnectMessage(drainer.delay())); err != nil {
+		return fmt.Errorf("sending reconnect message: %w", err)
+	}
+	return nil
+}
+
+// controlMessage is a message from the client to change the requested keys.
+//
+// The type is `add` or `remove`. The data is a list of keysbuilder bodies like
+// the body of an autoupdate request.
+type controlMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// apply changes the keysbuilder.
+//
+// The DataProvider, that uses the keysbuilder, must not run at the same time.
+func (c controlMessage) apply(kb *keysbuilder.Builder) error {
+	if c.Type != "add" && c.Type != "remove" {
+		return invalidRequestError{fmt.Errorf("unknown control message type `%s`", c.Type)}
+	}
+
+	builder, err := keysbuilder.ManyFromJSON(bytes.NewReader(c.Data))
+	if err != nil {
+		return fmt.Errorf("building keysbuilder from control message: %w", err)
+	}
+
+	if c.Type == "add" {
+		kb.Add(builder)
+		return nil
+	}
+
+	kb.Remove(builder)
+	return nil
+}
+
+// readWebsocketFrames reads the frames from the client until the connection is
+// closed.
+//
+// Ping and close frames are handled by the websocket package. Text frames have
+// to be control messages. They are sent to the given channel.
+func readWebsocketFrames(ctx context.Context, conn *websocket.Conn, controls chan<- controlMessage) error {
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			if !errors.Is(err, websocket.ErrFrameTooLarge) {
+				return fmt.Errorf("reading frame: %w", err)
+			}
+
+			handleWebsocketError(conn, invalidRequestError{fmt.Errorf("control message is too big")})
+			continue
+		}
+
+		var control controlMessage
+		if err := json.Unmarshal(msg, &control); err != nil {
+			handleWebsocketError(conn, invalidRequestError{fmt.Errorf("invalid control message: %w", err)})
+			continue
+		}
+
+		select {
+		case controls <- control:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handleWebsocketError sends an error as text frame to the client.
+func handleWebsocketError(conn *websocket.Conn, err error) {
+	msg := errorFrame(err)
+	if msg == "" {
+		// Client closed connection.
+		return
+	}
+
+	// The error can not be handled, if the connection is already broken.
+	_ = websocket.Message.Send(conn, msg)
+}
+
+// errorFrame returns the content of a websocket frame for an error.
+func errorFrame(err error) string {
+	_, msg := errorMessage(err)
+	return strings.TrimSpace(msg)
+}
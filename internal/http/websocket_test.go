@@ -0,0 +1,264 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/autoupdate"
+	ahttp "github.com/OpenSlides/openslides-autoupdate-service/internal/http"
+	"github.com/OpenSlides/openslides-autoupdate-service/internal/test"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/dsmock"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebsocket(t *testing.T) {
+	mux := http.NewServeMux()
+	var called bool
+	connecter := &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			if called {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			called = true
+			return map[string][]byte{"foo": []byte(`"bar"`)}, nil
+		},
+	}
+	ahttp.Websocket(mux, test.Auth(1), connecter, nil, nil, nil, nil)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/system/autoupdate/websocket?k=user/1/name"
+	conn, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	var got string
+	if err := websocket.Message.Receive(conn, &got); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+
+	if expect := `{"foo":"bar"}`; got != expect {
+		t.Errorf("Got frame %q, expected %q", got, expect)
+	}
+}
+
+func TestWebsocketInvalidControlMessage(t *testing.T) {
+	mux := http.NewServeMux()
+	connecter := &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	ahttp.Websocket(mux, test.Auth(1), connecter, nil, nil, nil, nil)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/system/autoupdate/websocket"
+	conn, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := websocket.Message.Send(conn, "hello"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var got string
+	if err := websocket.Message.Receive(conn, &got); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+
+	expect := `{"error": {"type": "invalid_request", "msg": "Invalid request: invalid control message: invalid character 'h' looking for beginning of value"}}`
+	if got != expect {
+		t.Errorf("Got frame %q, expected %q", got, expect)
+	}
+}
+
+// keysConnecter is a Connecter that returns all keys from the keysbuilder each
+// time the keysbuilder was changed.
+type keysConnecter struct{}
+
+func (keysConnecter) Connect(userID int, kb autoupdate.KeysBuilder) autoupdate.DataProvider {
+	return func(ctx context.Context) (map[string][]byte, error) {
+		if changer, ok := kb.(interface{ Changed() bool }); !ok || !changer.Changed() {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+
+		if err := kb.Update(ctx, dsmock.Stub{}); err != nil {
+			return nil, err
+		}
+
+		data := make(map[string][]byte)
+		for _, k := range kb.Keys() {
+			data[k] = []byte(`"value"`)
+		}
+		return data, nil
+	}
+}
+
+func (keysConnecter) Resume(userID int, kb autoupdate.KeysBuilder, lastID string, listDiff bool) autoupdate.MessageProvider {
+	return func(ctx context.Context) (autoupdate.Message, error) {
+		return autoupdate.Message{}, fmt.Errorf("not implemented")
+	}
+}
+
+func (keysConnecter) Multiplex(userID int, kbs map[string]autoupdate.KeysBuilder, listDiff bool) autoupdate.MessageProvider {
+	return func(ctx context.Context) (autoupdate.Message, error) {
+		return autoupdate.Message{}, fmt.Errorf("not implemented")
+	}
+}
+
+func (keysConnecter) SingleData(ctx context.Context, userID int, kb autoupdate.KeysBuilder, position int) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func TestWebsocketControlMessage(t *testing.T) {
+	mux := http.NewServeMux()
+	ahttp.Websocket(mux, test.Auth(1), keysConnecter{}, nil, nil, nil, nil)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/system/autoupdate/websocket?k=user/1/name"
+	conn, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	for _, tt := range []struct {
+		name    string
+		control string
+		expect  string
+	}{
+		{
+			"add",
+			`{"type":"add","data":[{"ids":[2],"collection":"user","fields":{"name":null}}]}`,
+			`{"user/1/name":"value","user/2/name":"value"}`,
+		},
+		{
+			"remove",
+			`{"type":"remove","data":[{"ids":[1],"collection":"user","fields":{"name":null}}]}`,
+			`{"user/2/name":"value"}`,
+		},
+		{
+			"unknown type",
+			`{"type":"unknown","data":[]}`,
+			`{"error": {"type": "invalid_request", "msg": "Invalid request: unknown control message type ` + "`unknown`" + `"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := websocket.Message.Send(conn, tt.control); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			var got string
+			if err := websocket.Message.Receive(conn, &got); err != nil {
+				t.Fatalf("Receive: %v", err)
+			}
+
+			if got != tt.expect {
+				t.Errorf("Got frame %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestWebsocketOrigin(t *testing.T) {
+	connecter := &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		origin  string
+		allowed []string
+		expect  bool
+	}{
+		{"same host", "", nil, true},
+		{"other site", "http://evil.example", nil, false},
+		{"allowed site", "https://openslides.example", []string{"https://openslides.example"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			ahttp.Websocket(mux, test.Auth(1), connecter, nil, nil, nil, tt.allowed)
+
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			origin := tt.origin
+			if origin == "" {
+				origin = srv.URL
+			}
+
+			url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/system/autoupdate/websocket"
+			conn, err := websocket.Dial(url, "", origin)
+			if err == nil {
+				conn.Close()
+			}
+
+			if got := err == nil; got != tt.expect {
+				t.Errorf("Dial with origin %s returned error %v, expected success: %t", origin, err, tt.expect)
+			}
+		})
+	}
+}
+
+// tokenAuth expects the token `my-token` and renews it.
+type tokenAuth struct {
+	test.Auth
+}
+
+func (a tokenAuth) Authenticate(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	if got := r.Header.Get("Authentication"); got != "bearer my-token" {
+		return nil, fmt.Errorf("got auth header %q", got)
+	}
+
+	w.Header().Set("Authentication", "new-token")
+	return a.Auth.Authenticate(w, r)
+}
+
+func TestWebsocketTokenFromQuery(t *testing.T) {
+	mux := http.NewServeMux()
+	connecter := &connecterMock{
+		func(ctx context.Context) (map[string][]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	ahttp.Websocket(mux, tokenAuth{test.Auth(1)}, connecter, nil, nil, nil, nil)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/system/autoupdate/websocket?authentication=my-token"
+	conn, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	var got string
+	if err := websocket.Message.Receive(conn, &got); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+
+	if expect := `{"token":"new-token"}`; strings.TrimSpace(got) != expect {
+		t.Errorf("Got frame %q, expected %q", got, expect)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -21,8 +22,9 @@ const keySep = "/"
 //
 // Has to be created with keysbuilder.FromJSON() or keysbuilder.ManyFromJSON().
 type Builder struct {
-	bodies []body
-	keys   []string
+	bodies  []body
+	keys    []string
+	changed bool
 }
 
 // FromKeys creates a keysbuilder from a list of keys.
@@ -62,6 +64,39 @@ func FromBuilders(builders ...*Builder) *Builder {
 	return builder
 }
 
+// Add adds the bodies of other builders to the builder.
+//
+// The keys of the new bodies are created on the next call to Update(). It is
+// not allowed to call Add() at the same time as Update().
+func (b *Builder) Add(builders ...*Builder) {
+	for _, other := range builders {
+		b.bodies = append(b.bodies, other.bodies...)
+	}
+	b.changed = true
+}
+
+// Remove removes bodies from the builder, that are equal to the bodies of the
+// other builders.
+//
+// The keys of the removed bodies are removed on the next call to Update(). It
+// is not allowed to call Remove() at the same time as Update().
+func (b *Builder) Remove(builders ...*Builder) {
+	bodies := b.bodies[:0]
+	for _, body := range b.bodies {
+		if !containsBody(builders, body) {
+			bodies = append(bodies, body)
+		}
+	}
+	b.bodies = bodies
+	b.changed = true
+}
+
+// Changed returns true, if bodies where added or removed since the last call
+// to Update().
+func (b *Builder) Changed() bool {
+	return b.changed
+}
+
 // Update triggers a key update. It generates the list of keys, that can be
 // requested with the Keys() method. It travels the KeysRequests object like a
 // tree.
@@ -72,10 +107,13 @@ func (b *Builder) Update(ctx context.Context, getter datastore.Getter) (err erro
 		// Reset keys if an error happens
 		if err != nil {
 			b.keys = b.keys[:0]
+			return
 		}
+		b.changed = false
 	}()
 
 	if len(b.bodies) == 0 {
+		b.keys = b.keys[:0]
 		return nil
 	}
 
@@ -148,6 +186,19 @@ func (b *Builder) Keys() []string {
 	return append(b.keys[:0:0], b.keys...)
 }
 
+// containsBody returns true, if one of the builders has a body that is equal to
+// the given body.
+func containsBody(builders []*Builder, b body) bool {
+	for _, builder := range builders {
+		for _, other := range builder.bodies {
+			if reflect.DeepEqual(b, other) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // buildGenericKey returns a valid key when the collection and id are already
 // together.
 //
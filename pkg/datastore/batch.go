@@ -0,0 +1,131 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batcher collects the keys of many Get calls and fetches them together.
+//
+// The first call starts a batch. All keys, that are requested in the next wait
+// duration, are added to the same batch. If the batch gets more then maxKeys
+// keys, it is fetched immediately.
+type batcher struct {
+	fetch   func(keys ...string) (map[string][]byte, error)
+	wait    time.Duration
+	maxKeys int
+
+	mu      sync.Mutex
+	current *batch
+
+	metricBatches     uint64
+	metricBatchKeys   uint64
+	metricMaxKeys     uint64
+	metricWaitNanosec uint64
+}
+
+// newBatcher initializes a batcher.
+func newBatcher(wait time.Duration, maxKeys int, fetch func(keys ...string) (map[string][]byte, error)) *batcher {
+	return &batcher{
+		fetch:   fetch,
+		wait:    wait,
+		maxKeys: maxKeys,
+	}
+}
+
+// batch is a group of keys, that are fetched together.
+type batch struct {
+	created time.Time
+	keys    map[string]struct{}
+	sent    bool
+
+	// done is closed, after data and err are set.
+	done chan struct{}
+	data map[string][]byte
+	err  error
+}
+
+// Get adds the keys to the current batch and waits for its result.
+func (b *batcher) Get(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	bt := b.add(keys)
+
+	select {
+	case <-bt.done:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for batch: %w", ctx.Err())
+	}
+
+	if bt.err != nil {
+		return nil, bt.err
+	}
+
+	data := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		data[key] = bt.data[key]
+	}
+	return data, nil
+}
+
+// add adds the keys to the current batch and returns it.
+func (b *batcher) add(keys []string) *batch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bt := b.current
+	if bt == nil {
+		bt = &batch{
+			created: time.Now(),
+			keys:    make(map[string]struct{}, len(keys)),
+			done:    make(chan struct{}),
+		}
+		b.current = bt
+		time.AfterFunc(b.wait, func() { b.send(bt) })
+	}
+
+	for _, key := range keys {
+		bt.keys[key] = struct{}{}
+	}
+
+	if b.maxKeys > 0 && len(bt.keys) >= b.maxKeys {
+		go b.send(bt)
+	}
+
+	return bt
+}
+
+// send fetches the keys of the batch. It does nothing, if the batch was
+// already sent.
+func (b *batcher) send(bt *batch) {
+	b.mu.Lock()
+	if bt.sent {
+		b.mu.Unlock()
+		return
+	}
+	bt.sent = true
+	if b.current == bt {
+		b.current = nil
+	}
+	b.mu.Unlock()
+
+	keys := make([]string, 0, len(bt.keys))
+	for key := range bt.keys {
+		keys = append(keys, key)
+	}
+
+	bt.data, bt.err = b.fetch(keys...)
+
+	atomic.AddUint64(&b.metricBatches, 1)
+	atomic.AddUint64(&b.metricBatchKeys, uint64(len(keys)))
+	atomic.AddUint64(&b.metricWaitNanosec, uint64(time.Since(bt.created)))
+	for {
+		max := atomic.LoadUint64(&b.metricMaxKeys)
+		if uint64(len(keys)) <= max || atomic.CompareAndSwapUint64(&b.metricMaxKeys, max, uint64(len(keys))) {
+			break
+		}
+	}
+
+	close(bt.done)
+}
@@ -0,0 +1,109 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func countingFetch(calls *int, mu *sync.Mutex) func(keys ...string) (map[string][]byte, error) {
+	return func(keys ...string) (map[string][]byte, error) {
+		mu.Lock()
+		*calls++
+		mu.Unlock()
+
+		data := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			data[key] = []byte(fmt.Sprintf(`"%s"`, key))
+		}
+		return data, nil
+	}
+}
+
+func TestBatcherMergesConcurrentCalls(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	b := newBatcher(50*time.Millisecond, 0, countingFetch(&calls, &mu))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("motion/%d/title", i)
+			data, err := b.Get(context.Background(), key)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if len(data) != 1 || string(data[key]) != fmt.Sprintf(`"%s"`, key) {
+				errs <- fmt.Errorf("got %v for key %s", data, key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if calls != 1 {
+		t.Errorf("fetch was called %d times, expected 1", calls)
+	}
+
+	if b.metricBatchKeys != 10 {
+		t.Errorf("metric batch keys is %d, expected 10", b.metricBatchKeys)
+	}
+}
+
+func TestBatcherMaxKeys(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	b := newBatcher(time.Hour, 2, countingFetch(&calls, &mu))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := b.Get(ctx, "key1", "key2"); err != nil {
+		t.Fatalf("Get returned: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("fetch was called %d times, expected 1", calls)
+	}
+}
+
+func TestBatcherError(t *testing.T) {
+	myErr := errors.New("my error")
+	b := newBatcher(time.Millisecond, 0, func(keys ...string) (map[string][]byte, error) {
+		return nil, myErr
+	})
+
+	_, err := b.Get(context.Background(), "key1")
+
+	if !errors.Is(err, myErr) {
+		t.Errorf("Get returned `%v`, expected `%v`", err, myErr)
+	}
+}
+
+func TestBatcherContextCanceled(t *testing.T) {
+	b := newBatcher(time.Hour, 0, func(keys ...string) (map[string][]byte, error) {
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := b.Get(ctx, "key1")
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Get returned `%v`, expected context.Canceled", err)
+	}
+}
@@ -2,11 +2,18 @@ package datastore
 
 import (
 	"bytes"
+	"container/list"
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// maxFetchAttempts decides how often GetOrSet fetches keys, that were evicted by
+// other callers before they could be read. Afterwards, the keys are fetched
+// without the cache.
+const maxFetchAttempts = 3
+
 // cacheSetFunc is a function to update cache keys.
 type cacheSetFunc func(keys []string, set func(key string, value []byte)) error
 
@@ -18,18 +25,41 @@ type cacheSetFunc func(keys []string, set func(key string, value []byte)) error
 // cache knows, that the key does not exist in the datastore. Each value
 // []byte("null") is changed to nil.
 //
-// A new cache instance has to be created with newCache().
+// If the cache has a max size, the least recently used keys are removed, when
+// the keys and values are bigger then this size. Removed keys do not receive
+// updates anymore. They are fetched again, when they are requested.
+//
+// A new cache instance has to be created with newCache() or
+// newBoundedCache().
 type cache struct {
 	data *pendingMap
 }
 
-// newCache creates an initialized cache instance.
+// newCache creates an initialized cache instance without a max size.
 func newCache() *cache {
+	return newBoundedCache(0, new(cacheStats))
+}
+
+// newBoundedCache creates a cache, that holds at most maxSize bytes. If maxSize
+// is 0, the cache is not limited.
+//
+// The stats are updated by the cache. They can be shared between different
+// cache instances.
+func newBoundedCache(maxSize int, stats *cacheStats) *cache {
 	return &cache{
-		data: newPendingMap(),
+		data: newPendingMap(maxSize, stats),
 	}
 }
 
+// cacheStats counts the cache hits, misses and evictions.
+//
+// The values have to be read with the atomic package.
+type cacheStats struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
 // GetOrSet returns the values for a list of keys. If one or more keys do not
 // exist in the cache, then the missing values are fetched with the given set
 // function. If this method is called more then once at the same time, only the
@@ -49,33 +79,86 @@ func newCache() *cache {
 //
 // If the context is done, GetOrSet returns. But the set() call is not stopped.
 // Other calls to GetOrSet may wait for its result.
+//
+// If the cache has a max size, the least recently used keys are evicted after
+// the values are read.
 func (c *cache) GetOrSet(ctx context.Context, keys []string, set cacheSetFunc) (map[string][]byte, error) {
-	// Blocks until all missing keys are fetched.
-	if err := c.fetchMissing(ctx, keys, set); err != nil {
-		return nil, fmt.Errorf("fetching missing keys: %w", err)
-	}
-
-	// Blocks until all keys that are requested by other callers are fetched.
 	values := make(map[string][]byte, len(keys))
-	for _, key := range keys {
-		// Gets a value and waits until it is ready.
-		v, err := c.data.get(ctx, key)
+
+	// A key can be evicted by another caller, after it was fetched. In this
+	// case, it is fetched again.
+	missing := keys
+	for attempt := 0; len(missing) > 0 && attempt < maxFetchAttempts; attempt++ {
+		// Blocks until all missing keys are fetched.
+		fetched, err := c.fetchMissing(ctx, missing, set)
 		if err != nil {
-			return nil, fmt.Errorf("waiting for key %s: %w", key, err)
+			return nil, fmt.Errorf("fetching missing keys: %w", err)
+		}
+
+		if attempt == 0 {
+			c.data.count(len(keys)-fetched, fetched)
 		}
 
-		values[key] = v
+		// Blocks until all keys that are requested by other callers are
+		// fetched.
+		var evicted []string
+		for _, key := range missing {
+			// Gets a value and waits until it is ready.
+			v, exists, err := c.data.get(ctx, key)
+			if err != nil {
+				return nil, fmt.Errorf("waiting for key %s: %w", key, err)
+			}
+
+			if !exists {
+				evicted = append(evicted, key)
+				continue
+			}
+
+			values[key] = v
+		}
+		missing = evicted
+	}
+
+	if len(missing) > 0 {
+		// The keys were evicted every time. The cache is too small for the
+		// current load. Fetch them without the cache.
+		if err := c.fetchUncached(missing, set, values); err != nil {
+			return nil, fmt.Errorf("fetching evicted keys: %w", err)
+		}
 	}
+
+	c.data.evict()
 	return values, nil
 }
 
+// fetchUncached loads the given keys with the set method and writes them into
+// values without using the cache.
+func (c *cache) fetchUncached(keys []string, set cacheSetFunc, values map[string][]byte) error {
+	for _, key := range keys {
+		values[key] = nil
+	}
+
+	return set(keys, func(key string, value []byte) {
+		if _, ok := values[key]; !ok {
+			return
+		}
+
+		if bytes.Equal(value, []byte("null")) {
+			value = nil
+		}
+		values[key] = value
+	})
+}
+
 // fetchMissing loads the given keys with the set method. Does not update keys
 // that are already in the cache.
-func (c *cache) fetchMissing(ctx context.Context, keys []string, set cacheSetFunc) error {
+//
+// Returns the number of keys, that were not in the cache.
+func (c *cache) fetchMissing(ctx context.Context, keys []string, set cacheSetFunc) (int, error) {
 	missingKeys := c.data.markPending(keys...)
 
 	if len(missingKeys) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	// Fetch missing keys in the background. Do not stop the fetching. Even
@@ -102,13 +185,13 @@ func (c *cache) fetchMissing(ctx context.Context, keys []string, set cacheSetFun
 	select {
 	case err := <-errChan:
 		if err != nil {
-			return fmt.Errorf("fetching key: %w", err)
+			return 0, fmt.Errorf("fetching key: %w", err)
 		}
 	case <-ctx.Done():
-		return fmt.Errorf("waiting for fetch missing: %w", ctx.Err())
+		return 0, fmt.Errorf("waiting for fetch missing: %w", ctx.Err())
 	}
 
-	return nil
+	return len(missingKeys), nil
 }
 
 // SetIfExist updates the cache if the key exists or is pending.
@@ -119,6 +202,65 @@ func (c *cache) SetIfExist(key string, value []byte) {
 // SetIfExistMany is like SetIfExist but with many keys.
 func (c *cache) SetIfExistMany(data map[string][]byte) {
 	c.data.setIfExistMany(data)
+	c.data.evict()
+}
+
+// snapshot returns a copy of the values of the given keys, that are in the
+// cache. Pending keys are skipped.
+func (c *cache) snapshot(keys []string) map[string][]byte {
+	c.data.RLock()
+	defer c.data.RUnlock()
+
+	data := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if value, ok := c.data.data[key]; ok {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// keys returns all keys in the cache.
+func (c *cache) keys() []string {
+	c.data.RLock()
+	defer c.data.RUnlock()
+
+	keys := make([]string, 0, len(c.data.data))
+	for key := range c.data.data {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// restore sets the values, if they are not already in the cache.
+func (c *cache) restore(data map[string][]byte) {
+	c.data.Lock()
+	for key, value := range data {
+		if _, ok := c.data.data[key]; ok {
+			continue
+		}
+		if _, ok := c.data.pending[key]; ok {
+			continue
+		}
+
+		if len(value) == 0 || bytes.Equal(value, []byte("null")) {
+			value = nil
+		}
+		c.data.setUnlocked(key, value)
+	}
+	c.data.Unlock()
+
+	c.data.evict()
+}
+
+// remove deletes the keys from the cache. Pending keys are not removed.
+func (c *cache) remove(keys ...string) {
+	c.data.remove(keys...)
+}
+
+// has returns true, if the key exists or is pending.
+func (c *cache) has(key string) bool {
+	return c.data.has(key)
 }
 
 func (c *cache) len() int {
@@ -130,17 +272,36 @@ func (c *cache) size() int {
 }
 
 // pendingMap is like a map but values are returned as pendingValues.
+//
+// If maxSize is not 0, the pendingMap remembers the order in which the keys
+// where used.
 type pendingMap struct {
 	sync.RWMutex
 	data    map[string][]byte
 	pending map[string]chan struct{}
+
+	// bytes is the size of all keys and values in data.
+	bytes   int
+	maxSize int
+	stats   *cacheStats
+
+	// lruMu protects lru and elements. It can be used while holding the
+	// read lock of the pendingMap. The front of lru is the most recently
+	// used key.
+	lruMu    sync.Mutex
+	lru      *list.List
+	elements map[string]*list.Element
 }
 
 // newPendingMap initializes a pendingDict.
-func newPendingMap() *pendingMap {
+func newPendingMap(maxSize int, stats *cacheStats) *pendingMap {
 	return &pendingMap{
-		data:    map[string][]byte{},
-		pending: map[string]chan struct{}{},
+		data:     map[string][]byte{},
+		pending:  map[string]chan struct{}{},
+		maxSize:  maxSize,
+		stats:    stats,
+		lru:      list.New(),
+		elements: map[string]*list.Element{},
 	}
 }
 
@@ -149,30 +310,141 @@ func newPendingMap() *pendingMap {
 // If the value is pending, the returned value will block until the value is not
 // pending anymore.
 //
-// Returns nil for a value that does not exist.
-func (pm *pendingMap) get(ctx context.Context, key string) ([]byte, error) {
-	var value []byte
+// Returns nil for a value that does not exist. exists is false, if the key is
+// not in the pendingMap, for example because it was evicted.
+func (pm *pendingMap) get(ctx context.Context, key string) (value []byte, exists bool, err error) {
 	var pending chan struct{}
 	reading(pm, func() {
 		pending = pm.pending[key]
-		value = pm.data[key]
+		value, exists = pm.data[key]
+		if exists {
+			pm.touch(key)
+		}
 	})
 
 	if pending == nil {
-		return value, nil
+		return value, exists, nil
 	}
 
 	select {
 	case <-pending:
 	case <-ctx.Done():
-		return nil, fmt.Errorf("waiting for value: %w", ctx.Err())
+		return nil, false, fmt.Errorf("waiting for value: %w", ctx.Err())
 	}
 
 	reading(pm, func() {
-		value = pm.data[key]
+		value, exists = pm.data[key]
+		if exists {
+			pm.touch(key)
+		}
 	})
 
-	return value, nil
+	return value, exists, nil
+}
+
+// touch marks the key as the most recently used key.
+//
+// Has to be called with a read or write lock.
+func (pm *pendingMap) touch(key string) {
+	if pm.maxSize == 0 {
+		return
+	}
+
+	pm.lruMu.Lock()
+	defer pm.lruMu.Unlock()
+
+	if element, ok := pm.elements[key]; ok {
+		pm.lru.MoveToFront(element)
+		return
+	}
+	pm.elements[key] = pm.lru.PushFront(key)
+}
+
+// setUnlocked sets a value and updates the size of the pendingMap.
+//
+// Has to be called with the write lock.
+func (pm *pendingMap) setUnlocked(key string, value []byte) {
+	if old, ok := pm.data[key]; ok {
+		pm.bytes -= len(key) + len(old)
+	}
+
+	pm.data[key] = value
+	pm.bytes += len(key) + len(value)
+	pm.touch(key)
+}
+
+// evict removes the least recently used keys until the pendingMap is smaller
+// then maxSize.
+func (pm *pendingMap) evict() {
+	if pm.maxSize == 0 {
+		return
+	}
+
+	// Most calls do not need to evict anything. Only take the write lock,
+	// if the map is too big.
+	if pm.size() <= pm.maxSize {
+		return
+	}
+
+	pm.Lock()
+	defer pm.Unlock()
+
+	pm.lruMu.Lock()
+	defer pm.lruMu.Unlock()
+
+	var evicted uint64
+	for pm.bytes > pm.maxSize {
+		element := pm.lru.Back()
+		if element == nil {
+			break
+		}
+
+		key := element.Value.(string)
+		pm.lru.Remove(element)
+		delete(pm.elements, key)
+
+		if value, ok := pm.data[key]; ok {
+			pm.bytes -= len(key) + len(value)
+			delete(pm.data, key)
+			evicted++
+		}
+	}
+
+	atomic.AddUint64(&pm.stats.evictions, evicted)
+}
+
+// remove deletes the keys from the pendingMap.
+func (pm *pendingMap) remove(keys ...string) {
+	pm.Lock()
+	defer pm.Unlock()
+
+	pm.lruMu.Lock()
+	defer pm.lruMu.Unlock()
+
+	for _, key := range keys {
+		value, ok := pm.data[key]
+		if !ok {
+			continue
+		}
+
+		pm.bytes -= len(key) + len(value)
+		delete(pm.data, key)
+
+		if element, ok := pm.elements[key]; ok {
+			pm.lru.Remove(element)
+			delete(pm.elements, key)
+		}
+	}
+}
+
+// has returns true, if the key exists or is pending.
+func (pm *pendingMap) has(key string) bool {
+	pm.RLock()
+	defer pm.RUnlock()
+
+	_, exists := pm.data[key]
+	_, pending := pm.pending[key]
+	return exists || pending
 }
 
 // markPending marks one or more keys as pending.
@@ -199,6 +471,12 @@ func (pm *pendingMap) markPending(keys ...string) []string {
 	return marked
 }
 
+// count adds cache hits and misses to the stats.
+func (pm *pendingMap) count(hits, misses int) {
+	atomic.AddUint64(&pm.stats.hits, uint64(hits))
+	atomic.AddUint64(&pm.stats.misses, uint64(misses))
+}
+
 // unMarkPending sets any key that is still pending not to be pending.
 //
 // Skips keys that are already pending or are already in the database.
@@ -235,7 +513,7 @@ func (pm *pendingMap) setIfExistUnlocked(key string, value []byte) {
 		value = nil
 	}
 
-	pm.data[key] = value
+	pm.setUnlocked(key, value)
 
 	if pending != nil {
 		close(pending)
@@ -276,7 +554,7 @@ func (pm *pendingMap) setIfPending(key string, value []byte) {
 			value = nil
 		}
 
-		pm.data[key] = value
+		pm.setUnlocked(key, value)
 		close(pending)
 		delete(pm.pending, key)
 	}
@@ -289,7 +567,7 @@ func (pm *pendingMap) setEmptyIfPending(keys ...string) {
 
 	for _, key := range keys {
 		if pending, isPending := pm.pending[key]; isPending {
-			pm.data[key] = nil
+			pm.setUnlocked(key, nil)
 			close(pending)
 			delete(pm.pending, key)
 		}
@@ -297,16 +575,18 @@ func (pm *pendingMap) setEmptyIfPending(keys ...string) {
 }
 
 func (pm *pendingMap) len() int {
+	pm.RLock()
+	defer pm.RUnlock()
+
 	return len(pm.data)
 }
 
-// size returns the size of all values in the cache in bytes.
+// size returns the size of all keys and values in the cache in bytes.
 func (pm *pendingMap) size() int {
-	var size int
-	for _, v := range pm.data {
-		size += len(v)
-	}
-	return size
+	pm.RLock()
+	defer pm.RUnlock()
+
+	return pm.bytes
 }
 
 type rlocker interface {
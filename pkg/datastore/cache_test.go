@@ -345,3 +345,119 @@ func TestUpdateManyNull(t *testing.T) {
 		t.Errorf("GetOrSet() returned (%q, %t) for key1, expected (nil, true)", k1, ok)
 	}
 }
+
+func TestCacheEvictLeastRecentlyUsed(t *testing.T) {
+	// Each key and value has a size of 5 bytes. So the cache can hold two of
+	// them.
+	c := newBoundedCache(10, new(cacheStats))
+	set := func(keys []string, set func(string, []byte)) error {
+		for _, key := range keys {
+			set(key, []byte("vv"))
+		}
+		return nil
+	}
+
+	for _, key := range []string{"ke1", "ke2"} {
+		if _, err := c.GetOrSet(context.Background(), []string{key}, set); err != nil {
+			t.Fatalf("GetOrSet(): %v", err)
+		}
+	}
+
+	// Use ke1, so ke2 is the least recently used key.
+	if _, err := c.GetOrSet(context.Background(), []string{"ke1"}, set); err != nil {
+		t.Fatalf("GetOrSet(): %v", err)
+	}
+
+	if _, err := c.GetOrSet(context.Background(), []string{"ke3"}, set); err != nil {
+		t.Fatalf("GetOrSet(): %v", err)
+	}
+
+	for key, expect := range map[string]bool{"ke1": true, "ke2": false, "ke3": true} {
+		if got := c.has(key); got != expect {
+			t.Errorf("has(%s) = %t, expected %t", key, got, expect)
+		}
+	}
+
+	if got := c.size(); got != 10 {
+		t.Errorf("size() = %d, expected 10", got)
+	}
+
+	// Evicted keys do not receive updates.
+	c.SetIfExist("ke2", []byte("new"))
+	if c.has("ke2") {
+		t.Errorf("evicted key was updated")
+	}
+}
+
+func TestCacheEvictBiggerThenMaxSize(t *testing.T) {
+	c := newBoundedCache(5, new(cacheStats))
+
+	got, err := c.GetOrSet(context.Background(), []string{"ke1", "ke2"}, func(keys []string, set func(string, []byte)) error {
+		set("ke1", []byte("v1"))
+		set("ke2", []byte("v2"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrSet(): %v", err)
+	}
+
+	expect := map[string][]byte{"ke1": []byte("v1"), "ke2": []byte("v2")}
+	require.Equal(t, expect, got)
+
+	if got := c.len(); got != 1 {
+		t.Errorf("len() = %d, expected 1", got)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	stats := new(cacheStats)
+	c := newBoundedCache(5, stats)
+	set := func(keys []string, set func(string, []byte)) error {
+		for _, key := range keys {
+			set(key, []byte("vv"))
+		}
+		return nil
+	}
+
+	for _, keys := range [][]string{{"ke1"}, {"ke1"}, {"ke2"}, {"ke1", "ke2"}} {
+		if _, err := c.GetOrSet(context.Background(), keys, set); err != nil {
+			t.Fatalf("GetOrSet(): %v", err)
+		}
+	}
+
+	// ke1 is a miss and then a hit. ke2 is a miss and evicts ke1. In the last
+	// call, ke1 is a miss and ke2 a hit. Afterwards ke1 is evicted again,
+	// since ke2 was read last.
+	if stats.hits != 2 || stats.misses != 3 || stats.evictions != 2 {
+		t.Errorf("Got %d hits, %d misses and %d evictions, expected 2, 3 and 2", stats.hits, stats.misses, stats.evictions)
+	}
+}
+
+func TestCacheGetOrSetAlwaysEvicted(t *testing.T) {
+	stats := new(cacheStats)
+	c := newBoundedCache(5, stats)
+
+	var calls int
+	got, err := c.GetOrSet(context.Background(), []string{"ke1"}, func(keys []string, set func(string, []byte)) error {
+		calls++
+		set("ke1", []byte("v1"))
+
+		// Another caller fills the cache, so ke1 is evicted before it is read.
+		c.restore(map[string][]byte{"other": []byte("value")})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrSet(): %v", err)
+	}
+
+	expect := map[string][]byte{"ke1": []byte("v1")}
+	require.Equal(t, expect, got)
+
+	if calls != maxFetchAttempts+1 {
+		t.Errorf("set was called %d times, expected %d", calls, maxFetchAttempts+1)
+	}
+
+	if stats.hits != 0 || stats.misses != 1 {
+		t.Errorf("Got %d hits and %d misses, expected 0 and 1", stats.hits, stats.misses)
+	}
+}
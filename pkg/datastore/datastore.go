@@ -44,6 +44,10 @@ type Source interface {
 	Get(ctx context.Context, key ...string) (map[string][]byte, error)
 
 	// Update is called frequently and should block until there is new data.
+	//
+	// If the source lost updates, it has to return an error with the method
+	// `MissedUpdates() bool` that returns true. In this case, the cached
+	// values of the source are removed.
 	Update(ctx context.Context) (map[string][]byte, error)
 }
 
@@ -55,7 +59,18 @@ type SourcePosition interface {
 
 // HistoryInformationer returns the history information.
 type HistoryInformationer interface {
-	HistoryInformation(ctx context.Context, fqid string, w io.Writer) error
+	HistoryInformation(ctx context.Context, fqids ...string) (map[string][]HistoryInformation, error)
+}
+
+// HistoryInformation is one entry in the history of an object.
+//
+// Information is a list of strings or an object from fqids to lists of
+// strings.
+type HistoryInformation struct {
+	Position    int             `json:"position"`
+	Timestamp   int             `json:"timestamp"`
+	UserID      int             `json:"user_id"`
+	Information json.RawMessage `json:"information"`
 }
 
 // Datastore can be used to get values from the datastore-service.
@@ -67,26 +82,45 @@ type Datastore struct {
 	defaultSource Source
 	keySource     map[string]Source
 
-	changeListeners  []func(map[string][]byte) error
-	calculatedFields map[string]func(ctx context.Context, key string, changed map[string][]byte) ([]byte, error)
-	calculatedKeys   map[string]string
+	changeListeners     []func(map[string][]byte) error
+	fullUpdateListeners []func()
+	calculatedFields    map[string]func(ctx context.Context, key string, changed map[string][]byte) ([]byte, error)
+
+	// calculatedMu protects calculatedKeys. The keys are added, when they are
+	// loaded, which does not happen under resetMu.
+	calculatedMu   sync.Mutex
+	calculatedKeys map[string]string
 
 	history HistoryInformationer
 
 	resetMu sync.Mutex
 
+	cacheMaxSize int
+	cacheStats   cacheStats
+
 	metricGetHitCount uint64
 }
 
+// Option is an optional argument for New().
+type Option func(*Datastore)
+
+// WithCacheMaxSize limits the cache to the given size in bytes.
+//
+// When the cache gets bigger, the least recently used keys are removed. A
+// value of 0 means, that the cache is not limited.
+func WithCacheMaxSize(bytes int) Option {
+	return func(d *Datastore) {
+		d.cacheMaxSize = bytes
+	}
+}
+
 // New returns a new Datastore object.
-func New(defaultSource Source, keySource map[string]Source, history HistoryInformationer) *Datastore {
+func New(defaultSource Source, keySource map[string]Source, history HistoryInformationer, options ...Option) *Datastore {
 	if keySource == nil {
 		keySource = make(map[string]Source)
 	}
 
 	d := &Datastore{
-		cache: newCache(),
-
 		defaultSource: defaultSource,
 		keySource:     keySource,
 
@@ -96,6 +130,12 @@ func New(defaultSource Source, keySource map[string]Source, history HistoryInfor
 		history: history,
 	}
 
+	for _, o := range options {
+		o(d)
+	}
+
+	d.cache = newBoundedCache(d.cacheMaxSize, &d.cacheStats)
+
 	metric.Register(d.metric)
 
 	return d
@@ -159,6 +199,27 @@ func (d *Datastore) RegisterChangeListener(f func(map[string][]byte) error) {
 	d.changeListeners = append(d.changeListeners, f)
 }
 
+// RegisterFullUpdateListener registers a function that is called, when values
+// were removed from the cache, because updates were missed.
+//
+// In this case, it is unknown which keys have changed. So all values have to be
+// read again.
+func (d *Datastore) RegisterFullUpdateListener(f func()) {
+	d.fullUpdateListeners = append(d.fullUpdateListeners, f)
+}
+
+// HealthInformation returns information about the sources, that are shown in
+// the health route.
+func (d *Datastore) HealthInformation() map[string]any {
+	informer, ok := d.defaultSource.(interface {
+		HealthInformation() map[string]any
+	})
+	if !ok {
+		return nil
+	}
+	return informer.HealthInformation()
+}
+
 // RegisterCalculatedField creates a virtual field that is not in the datastore
 // but is created at runtime.
 //
@@ -178,13 +239,13 @@ func (d *Datastore) RegisterCalculatedField(
 // ResetCache clears the internal cache.
 func (d *Datastore) ResetCache() {
 	d.resetMu.Lock()
-	d.cache = newCache()
+	d.cache = newBoundedCache(d.cacheMaxSize, &d.cacheStats)
 	d.resetMu.Unlock()
 }
 
-// HistoryInformation writes the history information for a fqid.
-func (d *Datastore) HistoryInformation(ctx context.Context, fqid string, w io.Writer) error {
-	return d.history.HistoryInformation(ctx, fqid, w)
+// HistoryInformation returns the history information for the fqids.
+func (d *Datastore) HistoryInformation(ctx context.Context, fqids ...string) (map[string][]HistoryInformation, error) {
+	return d.history.HistoryInformation(ctx, fqids...)
 }
 
 // ListenOnUpdates listens for updates and informs all listeners.
@@ -193,7 +254,13 @@ func (d *Datastore) ListenOnUpdates(ctx context.Context, errHandler func(error))
 		errHandler = func(error) {}
 	}
 
-	updatedValues := make(chan map[string][]byte)
+	type sourceUpdate struct {
+		source Source
+		data   map[string][]byte
+		missed bool
+	}
+
+	updates := make(chan sourceUpdate)
 	sources := make([]Source, 0, len(d.keySource)+1)
 	sources = append(sources, d.defaultSource)
 	for _, s := range d.keySource {
@@ -213,25 +280,46 @@ func (d *Datastore) ListenOnUpdates(ctx context.Context, errHandler func(error))
 					}
 
 					errHandler(fmt.Errorf("update data: %w", err))
+
+					var errMissed interface{ MissedUpdates() bool }
+					if errors.As(err, &errMissed) && errMissed.MissedUpdates() {
+						updates <- sourceUpdate{source: source, missed: true}
+						continue
+					}
+
 					time.Sleep(messageBusReconnectPause)
 					continue
 				}
-				updatedValues <- data
+				updates <- sourceUpdate{source: source, data: data}
 			}
 		}(source)
 	}
 
 	go func() {
 		wg.Wait()
-		close(updatedValues)
+		close(updates)
 	}()
 
-	for data := range updatedValues {
+	for update := range updates {
+		if update.missed {
+			d.invalidate(update.source)
+			continue
+		}
+
+		data := update.data
+
 		// The lock prefents a cache reset while data is updating.
 		d.resetMu.Lock()
 		d.cache.SetIfExistMany(data)
 
-		for key, field := range d.calculatedKeys {
+		for key, field := range d.copyCalculatedKeys() {
+			if !d.cache.has(key) {
+				// The key was evicted from the cache. It is calculated
+				// again, when it is requested the next time.
+				d.removeCalculatedKeys(key)
+				continue
+			}
+
 			bs := d.calculateField(field, key, data)
 
 			// Update the cache and also update the data-map. The data-map is
@@ -249,6 +337,28 @@ func (d *Datastore) ListenOnUpdates(ctx context.Context, errHandler func(error))
 	}
 }
 
+// invalidate removes all values of the source and all calculated values from
+// the cache and informs the full update listeners.
+//
+// Calculated values are removed, since they could depend on the values of the
+// source.
+func (d *Datastore) invalidate(source Source) {
+	d.resetMu.Lock()
+	defer d.resetMu.Unlock()
+
+	calculatedKeys, normalKeys := d.splitCalculatedKeys(d.cache.keys())
+	keys := normalKeys[source]
+	for key := range calculatedKeys {
+		keys = append(keys, key)
+		d.removeCalculatedKeys(key)
+	}
+	d.cache.remove(keys...)
+
+	for _, f := range d.fullUpdateListeners {
+		f()
+	}
+}
+
 // splitCalculatedKeys splits a list of keys in calculated keys and "normal"
 // keys. The calculated keys are returned as map that point to the field name.
 func (d *Datastore) splitCalculatedKeys(keys []string) (map[string]string, map[Source][]string) {
@@ -289,12 +399,41 @@ func (d *Datastore) loadKeys(keys []string, set func(string, []byte)) error {
 
 	for key, field := range calculatedKeys {
 		calculated := d.calculateField(field, key, nil)
-		d.calculatedKeys[key] = field
+		d.addCalculatedKey(key, field)
 		set(key, calculated)
 	}
 	return nil
 }
 
+// copyCalculatedKeys returns a copy of the calculated keys, so they can be
+// calculated without holding the lock.
+func (d *Datastore) copyCalculatedKeys() map[string]string {
+	d.calculatedMu.Lock()
+	defer d.calculatedMu.Unlock()
+
+	keys := make(map[string]string, len(d.calculatedKeys))
+	for key, field := range d.calculatedKeys {
+		keys[key] = field
+	}
+	return keys
+}
+
+func (d *Datastore) addCalculatedKey(key, field string) {
+	d.calculatedMu.Lock()
+	defer d.calculatedMu.Unlock()
+
+	d.calculatedKeys[key] = field
+}
+
+func (d *Datastore) removeCalculatedKeys(keys ...string) {
+	d.calculatedMu.Lock()
+	defer d.calculatedMu.Unlock()
+
+	for _, key := range keys {
+		delete(d.calculatedKeys, key)
+	}
+}
+
 func (d *Datastore) calculateField(field string, key string, updated map[string][]byte) []byte {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -280,6 +280,47 @@ func TestCalculatedFieldsNoDBQuery(t *testing.T) {
 	}
 }
 
+func TestCalculatedFieldsGetWhileUpdate(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := dsmock.NewStubWithUpdate(dsmock.Stub(map[string][]byte{
+		"collection/1/normal_field": []byte(`"original value"`),
+	}))
+
+	ds := datastore.New(source, nil, source)
+	go ds.ListenOnUpdates(shutdownCtx, func(err error) { log.Println(err) })
+
+	ds.RegisterCalculatedField("collection/myfield", func(ctx context.Context, key string, changed map[string][]byte) ([]byte, error) {
+		return []byte(`"calculated"`), nil
+	})
+
+	updated := make(chan struct{})
+	ds.RegisterChangeListener(func(map[string][]byte) error {
+		updated <- struct{}{}
+		return nil
+	})
+
+	// Load new calculated keys while the updates are processed. Run with
+	// -race to find concurrent access to the calculated keys.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			if _, err := ds.Get(context.Background(), fmt.Sprintf("collection/%d/myfield", i)); err != nil {
+				t.Errorf("Get returned unexpected error: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		source.Send(dsmock.YAMLData(fmt.Sprintf("collection/1/normal_field: value %d", i)))
+		<-updated
+	}
+	<-done
+}
+
 func TestChangeListeners(t *testing.T) {
 	shutdownCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -376,3 +417,53 @@ func TestResetWhileUpdate(t *testing.T) {
 	// There is nothing to assert. This test is only for the race detector. Make
 	// sure to run the tests with the -race flag.
 }
+
+// missingSource is a source, that returns a missed updates error on Update.
+type missingSource struct {
+	dsmock.Stub
+	missed chan struct{}
+}
+
+func (s *missingSource) Update(ctx context.Context) (map[string][]byte, error) {
+	select {
+	case <-s.missed:
+		return nil, missedError{}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type missedError struct{}
+
+func (missedError) Error() string       { return "missed updates" }
+func (missedError) MissedUpdates() bool { return true }
+
+func TestMissedUpdates(t *testing.T) {
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := &missingSource{
+		Stub:   dsmock.Stub{"collection/1/field": []byte(`"old"`)},
+		missed: make(chan struct{}),
+	}
+
+	ds := datastore.New(source, nil, nil)
+	go ds.ListenOnUpdates(shutdownCtx, nil)
+
+	done := make(chan struct{})
+	ds.RegisterFullUpdateListener(func() {
+		close(done)
+	})
+
+	_, err := ds.Get(context.Background(), "collection/1/field")
+	require.NoError(t, err)
+
+	// Change the value without telling the datastore.
+	source.Stub["collection/1/field"] = []byte(`"new"`)
+	source.missed <- struct{}{}
+	<-done
+
+	got, err := ds.Get(context.Background(), "collection/1/field")
+	require.NoError(t, err)
+	assert.Equal(t, `"new"`, string(got["collection/1/field"]))
+}
@@ -1,6 +1,9 @@
 package datastore
 
 import (
+	"sync/atomic"
+	"time"
+
 	"github.com/OpenSlides/openslides-autoupdate-service/internal/metric"
 )
 
@@ -8,10 +11,35 @@ func (d *Datastore) metric(values metric.Container) {
 	c := values.Sub("datastore")
 	c.Add("cache_key_len", d.cache.len())
 	c.Add("cache_size", d.cache.size())
+	c.Add("cache_max_size", d.cacheMaxSize)
+	c.Add("cache_hits", atomic.LoadUint64(&d.cacheStats.hits))
+	c.Add("cache_misses", atomic.LoadUint64(&d.cacheStats.misses))
+	c.Add("cache_evictions", atomic.LoadUint64(&d.cacheStats.evictions))
 	c.Add("get_calls", d.metricGetHitCount)
 
 	ds, ok := d.defaultSource.(*SourceDatastore)
 	if ok {
-		c.Add("ds_hits", ds.metricDSHitCount)
+		c.Add("ds_hits", atomic.LoadUint64(&ds.metricDSHitCount))
+
+		if b := ds.batcher; b != nil {
+			batches := atomic.LoadUint64(&b.metricBatches)
+			c.Add("batch_count", batches)
+			c.Add("batch_keys", atomic.LoadUint64(&b.metricBatchKeys))
+			c.Add("batch_max_keys", atomic.LoadUint64(&b.metricMaxKeys))
+			if batches > 0 {
+				c.Add("batch_avg_keys", atomic.LoadUint64(&b.metricBatchKeys)/batches)
+				c.Add("batch_avg_latency_ms", time.Duration(atomic.LoadUint64(&b.metricWaitNanosec)/batches).Milliseconds())
+			}
+		}
+
+		if r := ds.retrier; r != nil {
+			c.Add("reader_retries", atomic.LoadUint64(&r.metricRetries))
+		}
+
+		if cb := ds.breaker; cb != nil {
+			c.Add("reader_circuit", cb.State())
+			c.Add("reader_circuit_opened", atomic.LoadUint64(&cb.metricOpened))
+			c.Add("reader_circuit_rejected", atomic.LoadUint64(&cb.metricRejected))
+		}
 	}
 }
@@ -0,0 +1,179 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen is returned, when the datastore reader is not asked, because
+// the last requests failed.
+var ErrCircuitOpen = errors.New("datastore reader is unavailable")
+
+// statusError is returned, when the datastore reader returns a status code
+// other then 200.
+type statusError struct {
+	status string
+	code   int
+	body   []byte
+}
+
+func (e statusError) Error() string {
+	if len(e.body) == 0 {
+		return fmt.Sprintf("datastore returned status %s", e.status)
+	}
+	return fmt.Sprintf("datastore returned status %s: %s", e.status, e.body)
+}
+
+// retryable tells, if a request, that failed with the error, should be sent
+// again.
+//
+// This is the case for server errors and network errors. Client errors like
+// an invalid request will not get better with a second try.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var errStatus statusError
+	if errors.As(err, &errStatus) {
+		return errStatus.code >= http.StatusInternalServerError
+	}
+
+	var errNet net.Error
+	return errors.As(err, &errNet)
+}
+
+// retrier sends a request again, if it fails with a retryable error.
+//
+// The time between the attempts doubles each time.
+type retrier struct {
+	attempts int
+	backoff  time.Duration
+
+	metricRetries uint64
+}
+
+// do calls f until it succeeds, returns an error, that is not retryable, or
+// the attempts are used up.
+func (r *retrier) do(ctx context.Context, f func() error) error {
+	wait := r.backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= r.attempts || !retryable(err) {
+			return err
+		}
+
+		atomic.AddUint64(&r.metricRetries, 1)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for retry after `%v`: %w", err, ctx.Err())
+		}
+		wait *= 2
+	}
+}
+
+// Circuit breaker states.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// circuitBreaker stops sending requests to the datastore reader after it
+// failed some times in a row.
+//
+// After the cooldown, one request is sent to test the reader. If it succeeds,
+// the circuit is closed again.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+
+	metricOpened   uint64
+	metricRejected uint64
+}
+
+// newCircuitBreaker initializes a closed circuit breaker.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     circuitClosed,
+	}
+}
+
+// allow returns ErrCircuitOpen, if no request should be sent.
+func (c *circuitBreaker) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case circuitOpen:
+		if time.Since(c.openedAt) < c.cooldown {
+			atomic.AddUint64(&c.metricRejected, 1)
+			return ErrCircuitOpen
+		}
+		c.state = circuitHalfOpen
+		return nil
+
+	case circuitHalfOpen:
+		// There is already a test request running.
+		atomic.AddUint64(&c.metricRejected, 1)
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// done has to be called after each allowed request with its result.
+func (c *circuitBreaker) done(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		// The request was canceled by the client. It does not say anything
+		// about the reader.
+		if c.state == circuitHalfOpen {
+			c.state = circuitOpen
+		}
+		return
+	}
+
+	if err == nil || !retryable(err) {
+		c.state = circuitClosed
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= c.threshold {
+		if c.state != circuitOpen {
+			atomic.AddUint64(&c.metricOpened, 1)
+		}
+		c.state = circuitOpen
+		c.openedAt = time.Now()
+	}
+}
+
+// State returns the current state of the circuit breaker.
+func (c *circuitBreaker) State() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == circuitOpen && time.Since(c.openedAt) >= c.cooldown {
+		return circuitHalfOpen
+	}
+	return c.state
+}
@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingReader returns a server that fails the first requests with a status
+// 500.
+func failingReader(t *testing.T, failures int32, calls *int32) *httptest.Server {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			http.Error(w, "reader is restarting", 500)
+			return
+		}
+		w.Write([]byte(`{"user":{"1":{"name":"hugo"}}}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSourceRetry(t *testing.T) {
+	var calls int32
+	ts := failingReader(t, 2, &calls)
+	source := NewSourceDatastore(ts.URL, nil, WithRetry(3, time.Millisecond))
+
+	got, err := source.Get(context.Background(), "user/1/name")
+	if err != nil {
+		t.Fatalf("Get returned: %v", err)
+	}
+
+	if string(got["user/1/name"]) != `"hugo"` {
+		t.Errorf("Got %q, expected %q", got["user/1/name"], `"hugo"`)
+	}
+
+	if calls != 3 {
+		t.Errorf("Reader was called %d times, expected 3", calls)
+	}
+}
+
+func TestSourceRetryGivesUp(t *testing.T) {
+	var calls int32
+	ts := failingReader(t, 5, &calls)
+	source := NewSourceDatastore(ts.URL, nil, WithRetry(2, time.Millisecond))
+
+	_, err := source.Get(context.Background(), "user/1/name")
+
+	var errStatus statusError
+	if !errors.As(err, &errStatus) || errStatus.code != 500 {
+		t.Errorf("Get returned `%v`, expected a status error", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("Reader was called %d times, expected 2", calls)
+	}
+}
+
+func TestSourceNoRetryOnClientError(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "invalid request", 400)
+	}))
+	defer ts.Close()
+	source := NewSourceDatastore(ts.URL, nil, WithRetry(3, time.Millisecond))
+
+	if _, err := source.Get(context.Background(), "user/1/name"); err == nil {
+		t.Errorf("Get returned no error")
+	}
+
+	if calls != 1 {
+		t.Errorf("Reader was called %d times, expected 1", calls)
+	}
+}
+
+func TestSourceCircuitBreaker(t *testing.T) {
+	var calls int32
+	ts := failingReader(t, 2, &calls)
+	source := NewSourceDatastore(ts.URL, nil, WithCircuitBreaker(2, 50*time.Millisecond))
+
+	for i := 0; i < 2; i++ {
+		if _, err := source.Get(context.Background(), "user/1/name"); err == nil {
+			t.Fatalf("Get %d returned no error", i)
+		}
+	}
+
+	if got := source.breaker.State(); got != circuitOpen {
+		t.Errorf("Circuit is %s, expected %s", got, circuitOpen)
+	}
+
+	_, err := source.Get(context.Background(), "user/1/name")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Get returned `%v`, expected `%v`", err, ErrCircuitOpen)
+	}
+
+	if calls != 2 {
+		t.Errorf("Reader was called %d times, expected 2", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := source.Get(context.Background(), "user/1/name"); err != nil {
+		t.Fatalf("Get after cooldown returned: %v", err)
+	}
+
+	if got := source.breaker.State(); got != circuitClosed {
+		t.Errorf("Circuit is %s, expected %s", got, circuitClosed)
+	}
+}
+
+func TestCircuitBreakerHalfOpenFails(t *testing.T) {
+	cb := newCircuitBreaker(1, time.Millisecond)
+	serverErr := statusError{status: "500 Internal Server Error", code: 500}
+
+	cb.done(serverErr)
+	time.Sleep(2 * time.Millisecond)
+
+	if err := cb.allow(); err != nil {
+		t.Fatalf("allow after cooldown returned: %v", err)
+	}
+
+	if err := cb.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second allow while half open returned `%v`, expected `%v`", err, ErrCircuitOpen)
+	}
+
+	cb.done(serverErr)
+
+	if err := cb.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow after failed test returned `%v`, expected `%v`", err, ErrCircuitOpen)
+	}
+}
@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// WriteSnapshot writes the cached values to w.
+//
+// Only the values of the default source are written. Calculated keys and keys
+// of other sources are fetched again, when they are requested.
+func (d *Datastore) WriteSnapshot(w io.Writer) error {
+	// The lock prevents a cache reset or an update while the snapshot is
+	// created.
+	d.resetMu.Lock()
+	defer d.resetMu.Unlock()
+
+	_, normalKeys := d.splitCalculatedKeys(d.cache.keys())
+	data := d.cache.snapshot(normalKeys[d.defaultSource])
+
+	if err := gob.NewEncoder(w).Encode(data); err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot adds the values from a snapshot, that was written with
+// WriteSnapshot, to the cache.
+//
+// changes are the updates, that happened after the snapshot was written. They
+// are applied to the values of the snapshot.
+func (d *Datastore) LoadSnapshot(r io.Reader, changes map[string][]byte) error {
+	var data map[string][]byte
+	if err := gob.NewDecoder(r).Decode(&data); err != nil {
+		return fmt.Errorf("decoding snapshot: %w", err)
+	}
+
+	for key, value := range changes {
+		if _, ok := data[key]; ok {
+			data[key] = value
+		}
+	}
+
+	d.resetMu.Lock()
+	defer d.resetMu.Unlock()
+
+	d.cache.restore(data)
+	return nil
+}
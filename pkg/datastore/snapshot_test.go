@@ -0,0 +1,68 @@
+package datastore_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/dsmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	source := dsmock.NewStubWithUpdate(dsmock.Stub(map[string][]byte{
+		"collection/1/field": []byte(`"v1"`),
+		"collection/2/field": []byte(`"v2"`),
+	}))
+	ds := datastore.New(source, nil, source)
+	ds.RegisterCalculatedField("collection/calculated", func(ctx context.Context, key string, changed map[string][]byte) ([]byte, error) {
+		return []byte(`"calculated"`), nil
+	})
+
+	_, err := ds.Get(context.Background(), "collection/1/field", "collection/2/field", "collection/3/field", "collection/1/calculated")
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, ds.WriteSnapshot(buf))
+
+	restoredSource := dsmock.NewStubWithUpdate(dsmock.Stub(map[string][]byte{
+		"collection/1/field": []byte(`"v1"`),
+		"collection/2/field": []byte(`"new"`),
+	}), dsmock.NewCounter)
+	restored := datastore.New(restoredSource, nil, restoredSource)
+	var calculated bool
+	restored.RegisterCalculatedField("collection/calculated", func(ctx context.Context, key string, changed map[string][]byte) ([]byte, error) {
+		calculated = true
+		return []byte(`"calculated"`), nil
+	})
+
+	changes := map[string][]byte{
+		"collection/2/field": []byte(`"new"`),
+		"collection/4/field": []byte(`"not cached"`),
+	}
+	require.NoError(t, restored.LoadSnapshot(buf, changes))
+
+	got, err := restored.Get(context.Background(), "collection/1/field", "collection/2/field", "collection/3/field")
+	require.NoError(t, err)
+
+	expect := map[string][]byte{
+		"collection/1/field": []byte(`"v1"`),
+		"collection/2/field": []byte(`"new"`),
+		"collection/3/field": nil,
+	}
+	assert.Equal(t, expect, got)
+
+	counter := restoredSource.Middlewares()[0].(*dsmock.Counter)
+	assert.Equal(t, 0, counter.Value(), "restored keys were requested from the source")
+
+	// Calculated keys are not in the snapshot.
+	_, err = restored.Get(context.Background(), "collection/1/calculated")
+	require.NoError(t, err)
+	assert.True(t, calculated, "calculated key was not calculated")
+
+	_, err = restored.Get(context.Background(), "collection/4/field")
+	require.NoError(t, err)
+	assert.Equal(t, 1, counter.Value(), "keys, that are not in the snapshot, have to be requested")
+}
@@ -3,11 +3,12 @@ package datastore
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -29,23 +30,89 @@ type SourceDatastore struct {
 	url     string
 	client  *http.Client
 	updater Updater // TODO: Replace this with the real redis backend.
+	batcher *batcher
+	retrier *retrier
+	breaker *circuitBreaker
 
 	metricDSHitCount uint64
 }
 
+// SourceOption is an optional argument for NewSourceDatastore.
+type SourceOption func(*SourceDatastore)
+
+// WithBatching collects the keys of concurrent Get calls and requests them
+// with one request.
+//
+// A batch is sent after wait or when it contains maxKeys keys. A maxKeys of 0
+// means no limit.
+func WithBatching(wait time.Duration, maxKeys int) SourceOption {
+	return func(s *SourceDatastore) {
+		s.batcher = newBatcher(wait, maxKeys, func(keys ...string) (map[string][]byte, error) {
+			// The request is shared by many callers. It can not use the
+			// context of one of them.
+			return s.get(context.Background(), keys...)
+		})
+	}
+}
+
+// WithTimeout sets the time after which a request to the datastore reader is
+// canceled.
+func WithTimeout(timeout time.Duration) SourceOption {
+	return func(s *SourceDatastore) {
+		s.client.Timeout = timeout
+	}
+}
+
+// WithRetry sends failed requests again, if the reader returned a server
+// error or could not be reached.
+//
+// A request is sent at most attempts times. The time between the attempts
+// starts with backoff and doubles each time.
+func WithRetry(attempts int, backoff time.Duration) SourceOption {
+	return func(s *SourceDatastore) {
+		s.retrier = &retrier{
+			attempts: attempts,
+			backoff:  backoff,
+		}
+	}
+}
+
+// WithCircuitBreaker stops sending requests to the reader after threshold
+// requests in a row failed. In this time, all requests fail with
+// ErrCircuitOpen. After the cooldown, one request is sent to test, if the
+// reader is available again.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) SourceOption {
+	return func(s *SourceDatastore) {
+		s.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
 // NewSourceDatastore initializes a SourceDatastore.
-func NewSourceDatastore(url string, updater Updater) *SourceDatastore {
-	return &SourceDatastore{
+func NewSourceDatastore(url string, updater Updater, options ...SourceOption) *SourceDatastore {
+	s := &SourceDatastore{
 		url: url,
 		client: &http.Client{
 			Timeout: httpTimeout,
 		},
 		updater: updater,
 	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
 }
 
 // Get fetches the request keys from the datastore-reader.
 func (s *SourceDatastore) Get(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	if s.batcher != nil {
+		return s.batcher.Get(ctx, keys...)
+	}
+	return s.get(ctx, keys...)
+}
+
+func (s *SourceDatastore) get(ctx context.Context, keys ...string) (map[string][]byte, error) {
 	atomic.AddUint64(&s.metricDSHitCount, 1)
 	return s.GetPosition(ctx, 0, keys...)
 }
@@ -59,30 +126,17 @@ func (s *SourceDatastore) GetPosition(ctx context.Context, position int, keys ..
 		return nil, fmt.Errorf("creating GetManyRequest: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", s.url+urlGetMany, bytes.NewReader(requestData))
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("requesting keys `%v`: %w", keys, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
+	var responseData map[string][]byte
+	err = s.post(ctx, urlGetMany, requestData, func(r io.Reader) error {
+		var err error
+		responseData, err = getManyResponseToKeyValue(r)
 		if err != nil {
-			return nil, fmt.Errorf("datastore returned status %s", resp.Status)
+			return fmt.Errorf("parse response: %w", err)
 		}
-		return nil, fmt.Errorf("datastore returned status %s: %s", resp.Status, body)
-	}
-
-	responseData, err := getManyResponseToKeyValue(resp.Body)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("parse response: %w", err)
+		return nil, fmt.Errorf("requesting keys `%v`: %w", keys, err)
 	}
 
 	// Add keys that where not returned.
@@ -96,39 +150,86 @@ func (s *SourceDatastore) GetPosition(ctx context.Context, position int, keys ..
 	return responseData, nil
 }
 
-// Update updates the data from the redis message bus.
-func (s *SourceDatastore) Update(ctx context.Context) (map[string][]byte, error) {
-	return s.updater.Update(ctx)
+// post sends a request to the datastore reader and decodes the response with
+// the given function.
+//
+// If the request fails, it is retried and registered at the circuit breaker.
+func (s *SourceDatastore) post(ctx context.Context, path string, body []byte, decode func(io.Reader) error) error {
+	send := func() error {
+		if s.breaker != nil {
+			if err := s.breaker.allow(); err != nil {
+				return err
+			}
+		}
+
+		err := s.send(ctx, path, body, decode)
+
+		if s.breaker != nil {
+			s.breaker.done(err)
+		}
+		return err
+	}
+
+	if s.retrier == nil {
+		return send()
+	}
+	return s.retrier.do(ctx, send)
 }
 
-// HistoryInformation requests the history information for an fqid from the datastore.
-func (s *SourceDatastore) HistoryInformation(ctx context.Context, fqid string, w io.Writer) error {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		s.url+urlHistoryInformation,
-		strings.NewReader(fmt.Sprintf(`{"fqids":[%q]}`, fqid)),
-	)
+// send sends one request to the datastore reader.
+func (s *SourceDatastore) send(ctx context.Context, path string, body []byte, decode func(io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url+path, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("creating request for datastore: %w", err)
+		return fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("sending request to datastore: %w", err)
+		return fmt.Errorf("sending request: %w", err)
 	}
 	defer resp.Body.Close()
-	defer io.ReadAll(resp.Body)
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("datastore returned %s", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return statusError{status: resp.Status, code: resp.StatusCode, body: body}
+	}
+
+	return decode(resp.Body)
+}
+
+// Update updates the data from the redis message bus.
+func (s *SourceDatastore) Update(ctx context.Context) (map[string][]byte, error) {
+	return s.updater.Update(ctx)
+}
+
+// HealthInformation returns the state of the circuit breaker.
+func (s *SourceDatastore) HealthInformation() map[string]any {
+	if s.breaker == nil {
+		return nil
+	}
+	return map[string]any{"datastore_reader": s.breaker.State()}
+}
+
+// HistoryInformation requests the history information for the fqids from the
+// datastore.
+func (s *SourceDatastore) HistoryInformation(ctx context.Context, fqids ...string) (map[string][]HistoryInformation, error) {
+	body, err := json.Marshal(map[string][]string{"fqids": fqids})
+	if err != nil {
+		return nil, fmt.Errorf("encoding request body: %w", err)
 	}
 
-	if _, err := io.Copy(w, resp.Body); err != nil {
-		return fmt.Errorf("copping datastore response to client: %w", err)
+	var history map[string][]HistoryInformation
+	err = s.post(ctx, urlHistoryInformation, body, func(r io.Reader) error {
+		if err := json.NewDecoder(r).Decode(&history); err != nil {
+			return fmt.Errorf("decoding datastore response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("requesting history information: %w", err)
 	}
 
-	return nil
+	return history, nil
 }
@@ -0,0 +1,440 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceFile is a datastore source, that reads the data from a json file in
+// the format of the OpenSlides example data.
+//
+// It does not need any other service and can be used for development and
+// demos. The data is held in memory. Each update creates a new position, so
+// the history routes also work.
+type SourceFile struct {
+	path          string
+	watchInterval time.Duration
+	updates       chan fileUpdate
+	updater       Updater
+	updaterOnce   sync.Once
+
+	mu   sync.RWMutex
+	data map[string][]byte
+
+	// changes holds the values of each key after each position, where the
+	// key changed. They are sorted by position.
+	changes map[string][]keyChange
+
+	// positions holds the fqids, that changed with each position. The first
+	// entry is the loaded file.
+	positions []filePosition
+
+	// fileData and modTime are the content of the file, when it was loaded
+	// the last time.
+	fileData map[string][]byte
+	modTime  time.Time
+}
+
+// fileUpdate is a change from the update reader.
+type fileUpdate struct {
+	data map[string][]byte
+	err  error
+}
+
+// keyChange is the value of a key after a position. A nil value means, that
+// the key was deleted.
+type keyChange struct {
+	position int
+	value    []byte
+}
+
+// filePosition are the fqids, that changed with one position.
+type filePosition struct {
+	timestamp int64
+	fqids     map[string]struct{}
+}
+
+// FileOption is an optional argument for NewSourceFile.
+type FileOption func(*SourceFile)
+
+// WithFileWatch checks the file for changes in the given interval. When the
+// file changed, it is loaded again and the difference is sent as update.
+func WithFileWatch(interval time.Duration) FileOption {
+	return func(s *SourceFile) {
+		s.watchInterval = interval
+	}
+}
+
+// WithUpdateReader reads updates from r. Each update has to be a json object
+// from keys to values in one line. A value of null deletes the key.
+//
+// The reader can be a named pipe. It should be opened for reading and
+// writing, so the source does not see an EOF when a writer closes the pipe.
+func WithUpdateReader(r io.Reader) FileOption {
+	return func(s *SourceFile) {
+		s.initUpdates()
+		go readFileUpdates(r, s.updates)
+	}
+}
+
+// WithUpdater also returns the updates from the updater, for example from a
+// message bus.
+func WithUpdater(updater Updater) FileOption {
+	return func(s *SourceFile) {
+		s.initUpdates()
+		s.updater = updater
+	}
+}
+
+func (s *SourceFile) initUpdates() {
+	if s.updates == nil {
+		s.updates = make(chan fileUpdate)
+	}
+}
+
+// NewSourceFile loads the file and initializes a SourceFile.
+func NewSourceFile(path string, options ...FileOption) (*SourceFile, error) {
+	s := &SourceFile{
+		path:    path,
+		data:    make(map[string][]byte),
+		changes: make(map[string][]keyChange),
+	}
+
+	data, modTime, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+
+	s.fileData = data
+	s.modTime = modTime
+	s.addPosition(data, modTime.Unix())
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s, nil
+}
+
+// Get returns the current values of the keys.
+func (s *SourceFile) Get(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	return s.GetPosition(ctx, 0, keys...)
+}
+
+// GetPosition returns the values of the keys at a position.
+//
+// The first position is the loaded file. Each update adds one position.
+// Position 0 means the current position.
+func (s *SourceFile) GetPosition(ctx context.Context, position int, keys ...string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[string][]byte, len(keys))
+	if position == 0 || position >= len(s.positions) {
+		for _, key := range keys {
+			out[key] = s.data[key]
+		}
+		return out, nil
+	}
+
+	for _, key := range keys {
+		changes := s.changes[key]
+
+		// Index of the first change after the position.
+		i := sort.Search(len(changes), func(i int) bool {
+			return changes[i].position > position
+		})
+
+		out[key] = nil
+		if i > 0 {
+			out[key] = changes[i-1].value
+		}
+	}
+	return out, nil
+}
+
+// Update blocks until the file changed or there is a line from the update
+// reader.
+//
+// The updater is started with the context of the first call.
+func (s *SourceFile) Update(ctx context.Context) (map[string][]byte, error) {
+	s.updaterOnce.Do(func() {
+		if s.updater != nil {
+			go s.readUpdater(ctx)
+		}
+	})
+
+	var tick <-chan time.Time
+	if s.watchInterval > 0 {
+		ticker := time.NewTicker(s.watchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case update := <-s.updates:
+			if update.err != nil {
+				return nil, fmt.Errorf("reading update: %w", update.err)
+			}
+
+			s.apply(update.data)
+			return update.data, nil
+
+		case <-tick:
+			changed, err := s.reload()
+			if err != nil {
+				return nil, fmt.Errorf("reloading %s: %w", s.path, err)
+			}
+
+			if len(changed) > 0 {
+				return changed, nil
+			}
+		}
+	}
+}
+
+// HistoryInformation returns a history entry for each position, that changed
+// one of the fqids.
+func (s *SourceFile) HistoryInformation(ctx context.Context, fqids ...string) (map[string][]HistoryInformation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[string][]HistoryInformation, len(fqids))
+	for _, fqid := range fqids {
+		for i, position := range s.positions {
+			if _, ok := position.fqids[fqid]; ok {
+				out[fqid] = append(out[fqid], HistoryInformation{
+					Position:  i + 1,
+					Timestamp: int(position.timestamp),
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// load reads the file.
+func (s *SourceFile) load() (map[string][]byte, time.Time, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("reading file info: %w", err)
+	}
+
+	data, err := decodeExampleData(f)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("decoding file: %w", err)
+	}
+
+	return data, info.ModTime(), nil
+}
+
+// reload loads the file, if it was modified, and returns the keys, that
+// changed in the file.
+//
+// Keys, that only changed with the update reader, are not overwritten.
+func (s *SourceFile) reload() (map[string][]byte, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file info: %w", err)
+	}
+
+	s.mu.RLock()
+	modified := !info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+
+	if !modified {
+		return nil, nil
+	}
+
+	// The modification time is only updated after the file could be read.
+	// So a file, that is only half written, is read again.
+	data, modTime, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make(map[string][]byte)
+	for key, value := range data {
+		if old, ok := s.fileData[key]; !ok || string(old) != string(value) {
+			changed[key] = value
+		}
+	}
+
+	for key := range s.fileData {
+		if _, ok := data[key]; !ok {
+			changed[key] = nil
+		}
+	}
+
+	s.fileData = data
+	s.modTime = modTime
+	s.applyUnlocked(changed)
+	return changed, nil
+}
+
+// apply updates the data and adds a new position.
+func (s *SourceFile) apply(changed map[string][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applyUnlocked(changed)
+}
+
+func (s *SourceFile) applyUnlocked(changed map[string][]byte) {
+	if len(changed) == 0 {
+		return
+	}
+
+	s.addPosition(changed, time.Now().Unix())
+}
+
+// addPosition changes the current data and remembers the changed values for
+// the new position.
+//
+// Has to be called with the write lock or before the SourceFile is used.
+func (s *SourceFile) addPosition(changed map[string][]byte, timestamp int64) {
+	position := len(s.positions) + 1
+	fqids := make(map[string]struct{})
+	for key, value := range changed {
+		if value == nil {
+			delete(s.data, key)
+		} else {
+			s.data[key] = value
+		}
+
+		s.changes[key] = append(s.changes[key], keyChange{position: position, value: value})
+
+		if parts := strings.SplitN(key, "/", 3); len(parts) == 3 {
+			fqids[parts[0]+"/"+parts[1]] = struct{}{}
+		}
+	}
+
+	s.positions = append(s.positions, filePosition{timestamp: timestamp, fqids: fqids})
+}
+
+// readUpdater sends the data from the updater to the updates channel until
+// the context is done.
+func (s *SourceFile) readUpdater(ctx context.Context) {
+	for {
+		data, err := s.updater.Update(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil && len(data) == 0 {
+			continue
+		}
+
+		select {
+		case s.updates <- fileUpdate{data: data, err: err}:
+		case <-ctx.Done():
+			return
+		}
+
+		if err != nil {
+			time.Sleep(messageBusReconnectPause)
+		}
+	}
+}
+
+// readFileUpdates reads json lines from r and sends them to the channel.
+//
+// It returns when the reader is exhausted.
+func readFileUpdates(r io.Reader, updates chan<- fileUpdate) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 10<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var decoded map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			updates <- fileUpdate{err: fmt.Errorf("invalid json: %w", err)}
+			continue
+		}
+
+		if invalid := InvalidKeys(keysOf(decoded)...); invalid != nil {
+			updates <- fileUpdate{err: invalidKeyError{keys: invalid}}
+			continue
+		}
+
+		data := make(map[string][]byte, len(decoded))
+		for key, value := range decoded {
+			data[key] = value
+			if string(value) == "null" {
+				data[key] = nil
+			}
+		}
+		updates <- fileUpdate{data: data}
+	}
+
+	if err := scanner.Err(); err != nil {
+		updates <- fileUpdate{err: fmt.Errorf("reading updates: %w", err)}
+	}
+}
+
+func keysOf(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// decodeExampleData decodes data in the format of the OpenSlides example data
+// to a map from fqfield to value.
+//
+// The format is a json object from collection to id to field to value. Top
+// level keys starting with an underscore, like `_migration_index`, are
+// ignored.
+func decodeExampleData(r io.Reader) (map[string][]byte, error) {
+	var decoded map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("decoding full file: %w", err)
+	}
+
+	data := make(map[string][]byte)
+	for collection, collectionData := range decoded {
+		if strings.HasPrefix(collection, "_") {
+			continue
+		}
+
+		var decodedCollection map[string]map[string]json.RawMessage
+		if err := json.Unmarshal(collectionData, &decodedCollection); err != nil {
+			return nil, fmt.Errorf("decoding collection %s: %w", collection, err)
+		}
+
+		for id, fields := range decodedCollection {
+			for field, value := range fields {
+				if string(value) == "null" {
+					continue
+				}
+				data[fmt.Sprintf("%s/%s/%s", collection, id, field)] = value
+			}
+		}
+	}
+	return data, nil
+}
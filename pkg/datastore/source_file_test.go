@@ -0,0 +1,216 @@
+package datastore_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
+)
+
+const exampleFile = `{
+	"_migration_index": 1,
+	"user": {"1": {"id": 1, "username": "admin"}},
+	"motion": {"5": {"id": 5, "title": "foo"}}
+}`
+
+func writeExampleFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "example-data.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing example file: %v", err)
+	}
+	return path
+}
+
+func TestSourceFileGet(t *testing.T) {
+	source, err := datastore.NewSourceFile(writeExampleFile(t, exampleFile))
+	if err != nil {
+		t.Fatalf("NewSourceFile: %v", err)
+	}
+
+	got, err := source.Get(context.Background(), "user/1/username", "motion/5/title", "motion/6/title")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	expect := map[string][]byte{
+		"user/1/username": []byte(`"admin"`),
+		"motion/5/title":  []byte(`"foo"`),
+		"motion/6/title":  nil,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got %q, expected %q", got, expect)
+	}
+}
+
+func TestSourceFileUpdateReader(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	source, err := datastore.NewSourceFile(writeExampleFile(t, exampleFile), datastore.WithUpdateReader(r))
+	if err != nil {
+		t.Fatalf("NewSourceFile: %v", err)
+	}
+
+	go w.Write([]byte("{\"motion/5/title\": \"bar\", \"user/1/username\": null}\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	got, err := source.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	expect := map[string][]byte{
+		"motion/5/title":  []byte(`"bar"`),
+		"user/1/username": nil,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Update returned %q, expected %q", got, expect)
+	}
+
+	t.Run("current position", func(t *testing.T) {
+		got, _ := source.Get(ctx, "motion/5/title", "user/1/username")
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Get returned %q, expected %q", got, expect)
+		}
+	})
+
+	t.Run("old position", func(t *testing.T) {
+		got, _ := source.GetPosition(ctx, 1, "motion/5/title", "user/1/username")
+		expect := map[string][]byte{
+			"motion/5/title":  []byte(`"foo"`),
+			"user/1/username": []byte(`"admin"`),
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("GetPosition returned %q, expected %q", got, expect)
+		}
+	})
+
+	t.Run("history information", func(t *testing.T) {
+		got, _ := source.HistoryInformation(ctx, "motion/5")
+		if len(got["motion/5"]) != 2 || got["motion/5"][1].Position != 2 {
+			t.Errorf("HistoryInformation returned %v, expected positions 1 and 2", got)
+		}
+	})
+}
+
+func TestSourceFileGetPosition(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	source, err := datastore.NewSourceFile(writeExampleFile(t, exampleFile), datastore.WithUpdateReader(r))
+	if err != nil {
+		t.Fatalf("NewSourceFile: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, line := range []string{
+		`{"motion/5/title": "bar", "user/1/username": null}`,
+		`{"motion/5/title": "baz"}`,
+	} {
+		go w.Write([]byte(line + "\n"))
+		if _, err := source.Update(ctx); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+
+	for position, expect := range map[int]map[string][]byte{
+		1: {"motion/5/title": []byte(`"foo"`), "user/1/username": []byte(`"admin"`)},
+		2: {"motion/5/title": []byte(`"bar"`), "user/1/username": nil},
+		3: {"motion/5/title": []byte(`"baz"`), "user/1/username": nil},
+	} {
+		got, err := source.GetPosition(ctx, position, "motion/5/title", "user/1/username")
+		if err != nil {
+			t.Fatalf("GetPosition: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("GetPosition(%d) returned %q, expected %q", position, got, expect)
+		}
+	}
+}
+
+func TestSourceFileWatch(t *testing.T) {
+	path := writeExampleFile(t, exampleFile)
+	source, err := datastore.NewSourceFile(path, datastore.WithFileWatch(time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewSourceFile: %v", err)
+	}
+
+	newContent := `{"user": {"1": {"id": 1, "username": "root"}}}`
+	if err := os.WriteFile(path, []byte(newContent), 0o600); err != nil {
+		t.Fatalf("writing example file: %v", err)
+	}
+
+	// Make sure the modification time is different, even on file systems
+	// with a low resolution.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("changing modification time: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	got, err := source.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	expect := map[string][]byte{
+		"user/1/username": []byte(`"root"`),
+		"motion/5/id":     nil,
+		"motion/5/title":  nil,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Update returned %q, expected %q", got, expect)
+	}
+}
+
+type updaterStub chan map[string][]byte
+
+func (u updaterStub) Update(ctx context.Context) (map[string][]byte, error) {
+	select {
+	case data := <-u:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestSourceFileUpdater(t *testing.T) {
+	updater := make(updaterStub, 1)
+	source, err := datastore.NewSourceFile(writeExampleFile(t, exampleFile), datastore.WithUpdater(updater))
+	if err != nil {
+		t.Fatalf("NewSourceFile: %v", err)
+	}
+
+	updater <- map[string][]byte{"motion/5/title": []byte(`"bar"`)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	got, err := source.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if string(got["motion/5/title"]) != `"bar"` {
+		t.Errorf("Update returned %q, expected motion/5/title", got)
+	}
+
+	value, _ := source.Get(ctx, "motion/5/title")
+	if string(value["motion/5/title"]) != `"bar"` {
+		t.Errorf("Get returned %q after the update", value)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"strconv"
 	"strings"
 
@@ -147,10 +146,9 @@ func (d *MockDatastore) ResetRequests() {
 	d.counter.Reset()
 }
 
-// HistoryInformation writes a fake history.
-func (d *MockDatastore) HistoryInformation(ctx context.Context, fqid string, w io.Writer) error {
-	w.Write([]byte(`[{"position":42,"user_id": 5,"information": "motion was created","timestamp: 1234567}]`))
-	return nil
+// HistoryInformation returns a fake history.
+func (d *MockDatastore) HistoryInformation(ctx context.Context, fqids ...string) (map[string][]datastore.HistoryInformation, error) {
+	return fakeHistory(fqids), nil
 }
 
 // KeysRequested returns true, if all given keys where requested.
@@ -3,7 +3,6 @@ package dsmock
 import (
 	"context"
 	"fmt"
-	"io"
 	"sync"
 
 	"github.com/OpenSlides/openslides-autoupdate-service/pkg/datastore"
@@ -97,10 +96,25 @@ func (s *StubWithUpdate) Middlewares() []datastore.Getter {
 	return s.middlewares
 }
 
-// HistoryInformation writes a fake history.
-func (s *StubWithUpdate) HistoryInformation(ctx context.Context, fqid string, w io.Writer) error {
-	w.Write([]byte(`[{"position":42,"user_id": 5,"information": "motion was created","timestamp: 1234567}]`))
-	return nil
+// HistoryInformation returns a fake history.
+func (s *StubWithUpdate) HistoryInformation(ctx context.Context, fqids ...string) (map[string][]datastore.HistoryInformation, error) {
+	return fakeHistory(fqids), nil
+}
+
+// fakeHistory returns the same history entry for each fqid.
+func fakeHistory(fqids []string) map[string][]datastore.HistoryInformation {
+	history := make(map[string][]datastore.HistoryInformation, len(fqids))
+	for _, fqid := range fqids {
+		history[fqid] = []datastore.HistoryInformation{
+			{
+				Position:    42,
+				Timestamp:   1234567,
+				UserID:      5,
+				Information: []byte(`["motion was created"]`),
+			},
+		}
+	}
+	return history
 }
 
 // Counter counts all keys that where requested.
@@ -0,0 +1,240 @@
+// Package messagebus contains message buses, that do not need an external
+// service like redis.
+//
+// They can be used for installations with only one autoupdate instance and for
+// tests.
+package messagebus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStoredMessages desides how many messages are kept to resume the
+// autoupdate stream.
+const maxStoredMessages = 1000
+
+// Memory is a message bus, that lives in the memory of the process.
+//
+// Messages can be published with Publish() and PublishLogout(). It implements
+// the same methods as the redis message bus.
+type Memory struct {
+	// epoch is part of each message id. With it, ids from another process
+	// can be detected.
+	epoch string
+
+	mu     sync.Mutex
+	notify chan struct{}
+
+	// The autoupdate and logout messages have their own ids. So a gap in the
+	// autoupdate ids always means, that messages were removed.
+	nextAutoupdateID uint64
+	nextLogoutID     uint64
+
+	autoupdates []autoupdateMessage
+	logouts     []logoutMessage
+
+	lastAutoupdateID uint64
+	lastLogoutID     uint64
+}
+
+type autoupdateMessage struct {
+	id   uint64
+	data map[string][]byte
+}
+
+type logoutMessage struct {
+	id         uint64
+	sessionIDs []string
+}
+
+// NewMemory initializes an empty memory message bus.
+func NewMemory() *Memory {
+	return &Memory{
+		epoch:            strconv.FormatInt(time.Now().UnixNano(), 10),
+		notify:           make(chan struct{}),
+		nextAutoupdateID: 1,
+		nextLogoutID:     1,
+	}
+}
+
+// Publish sends changed data to the autoupdate stream.
+//
+// A nil value means, that the key was deleted.
+func (m *Memory) Publish(data map[string][]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.autoupdates = append(m.autoupdates, autoupdateMessage{id: m.nextAutoupdateID, data: data})
+	if len(m.autoupdates) > maxStoredMessages {
+		m.autoupdates = m.autoupdates[len(m.autoupdates)-maxStoredMessages:]
+	}
+	m.nextAutoupdateID++
+	m.wakeUnlocked()
+}
+
+// PublishLogout sends session ids to the logout stream.
+func (m *Memory) PublishLogout(sessionIDs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.logouts = append(m.logouts, logoutMessage{id: m.nextLogoutID, sessionIDs: sessionIDs})
+	if len(m.logouts) > maxStoredMessages {
+		m.logouts = m.logouts[len(m.logouts)-maxStoredMessages:]
+	}
+	m.nextLogoutID++
+	m.wakeUnlocked()
+}
+
+// wakeUnlocked wakes all goroutines, that wait for a message.
+func (m *Memory) wakeUnlocked() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+// Update is a blocking function that returns, when there is new data.
+//
+// If messages were removed before they were read, an error of type
+// MissedUpdatesError is returned.
+func (m *Memory) Update(ctx context.Context) (map[string][]byte, error) {
+	for {
+		m.mu.Lock()
+		data, err := m.autoupdatesSinceUnlocked()
+		notify := m.notify
+		m.mu.Unlock()
+
+		if err != nil || data != nil {
+			return data, err
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// autoupdatesSinceUnlocked returns the merged data of all messages after
+// lastAutoupdateID and moves lastAutoupdateID to the last message. It returns
+// nil, if there are no new messages.
+func (m *Memory) autoupdatesSinceUnlocked() (map[string][]byte, error) {
+	if len(m.autoupdates) == 0 {
+		return nil, nil
+	}
+
+	first := m.autoupdates[0].id
+	if m.lastAutoupdateID != 0 && m.lastAutoupdateID+1 < first {
+		lastID := m.lastAutoupdateID
+
+		// The next call returns all messages, that still exist.
+		m.lastAutoupdateID = first - 1
+		return nil, MissedUpdatesError{reason: fmt.Sprintf("message %d was removed. First message is %d", lastID, first)}
+	}
+
+	var data map[string][]byte
+	for _, msg := range m.autoupdates {
+		if msg.id <= m.lastAutoupdateID {
+			continue
+		}
+
+		if data == nil {
+			data = make(map[string][]byte)
+		}
+
+		for k, v := range msg.data {
+			data[k] = v
+		}
+		m.lastAutoupdateID = msg.id
+	}
+	return data, nil
+}
+
+// LogoutEvent is a blocking function that returns, when a session was revoked.
+func (m *Memory) LogoutEvent(ctx context.Context) ([]string, error) {
+	for {
+		m.mu.Lock()
+		var sessionIDs []string
+		for _, msg := range m.logouts {
+			if msg.id <= m.lastLogoutID {
+				continue
+			}
+			sessionIDs = append(sessionIDs, msg.sessionIDs...)
+			m.lastLogoutID = msg.id
+		}
+		notify := m.notify
+		m.mu.Unlock()
+
+		if sessionIDs != nil {
+			return sessionIDs, nil
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// LastAutoupdateID returns the id of the last message, that was returned by
+// Update(). It is empty, if Update() did not return a message yet.
+func (m *Memory) LastAutoupdateID() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastAutoupdateID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d", m.epoch, m.lastAutoupdateID)
+}
+
+// ResumeAutoupdate returns the changes from all messages after the given id.
+// It does not block. Afterwards, Update() returns the messages after the last
+// returned message.
+//
+// The messages only live as long as the process. An id from another process
+// returns a MissedUpdatesError.
+func (m *Memory) ResumeAutoupdate(ctx context.Context, id string) (map[string][]byte, error) {
+	epoch, rawID, ok := strings.Cut(id, "-")
+	if !ok || epoch != m.epoch {
+		return nil, MissedUpdatesError{reason: fmt.Sprintf("message %s is from another process", id)}
+	}
+
+	lastID, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id %s: %w", id, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastAutoupdateID = lastID
+	data, err := m.autoupdatesSinceUnlocked()
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		data = make(map[string][]byte)
+	}
+	return data, nil
+}
+
+// MissedUpdatesError is returned by Update(), when messages could be missed.
+type MissedUpdatesError struct {
+	reason string
+}
+
+func (e MissedUpdatesError) Error() string {
+	return fmt.Sprintf("updates could be missed: %s", e.reason)
+}
+
+// MissedUpdates tells the datastore, that the values could be outdated.
+func (e MissedUpdatesError) MissedUpdates() bool {
+	return true
+}
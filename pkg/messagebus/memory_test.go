@@ -0,0 +1,173 @@
+package messagebus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/messagebus"
+)
+
+func TestMemoryUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := messagebus.NewMemory()
+	bus.Publish(map[string][]byte{"user/1/name": []byte(`"foo"`)})
+	bus.Publish(map[string][]byte{"user/1/name": []byte(`"bar"`), "user/2/name": nil})
+
+	data, err := bus.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	expect := map[string][]byte{"user/1/name": []byte(`"bar"`), "user/2/name": nil}
+	if !reflect.DeepEqual(data, expect) {
+		t.Errorf("Update returned %q, expected %q", data, expect)
+	}
+}
+
+func TestMemoryUpdateBlocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := messagebus.NewMemory()
+
+	received := make(chan map[string][]byte)
+	go func() {
+		data, _ := bus.Update(ctx)
+		received <- data
+	}()
+
+	select {
+	case <-received:
+		t.Fatalf("Update returned before a message was published")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	bus.Publish(map[string][]byte{"user/1/name": []byte(`"foo"`)})
+
+	select {
+	case data := <-received:
+		if string(data["user/1/name"]) != `"foo"` {
+			t.Errorf("Update returned %q, expected user/1/name", data)
+		}
+	case <-ctx.Done():
+		t.Fatalf("Update did not return after a message was published")
+	}
+}
+
+func TestMemoryUpdateWithLogouts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := messagebus.NewMemory()
+	bus.Publish(map[string][]byte{"user/1/name": []byte(`"foo"`)})
+	if _, err := bus.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	bus.PublishLogout("session1")
+	bus.Publish(map[string][]byte{"user/1/name": []byte(`"bar"`)})
+
+	data, err := bus.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update returned `%v` after a logout message", err)
+	}
+
+	if string(data["user/1/name"]) != `"bar"` {
+		t.Errorf("Update returned %q, expected user/1/name", data)
+	}
+}
+
+func TestMemoryUpdateMissedMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := messagebus.NewMemory()
+	bus.Publish(map[string][]byte{"user/1/name": []byte(`"first"`)})
+	if _, err := bus.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// Publish more messages than the bus keeps, so the second message is
+	// removed.
+	for i := 0; i < 1001; i++ {
+		bus.Publish(map[string][]byte{fmt.Sprintf("user/%d/name", i+2): []byte(`"value"`)})
+	}
+
+	_, err := bus.Update(ctx)
+	var errMissed interface{ MissedUpdates() bool }
+	if !errors.As(err, &errMissed) || !errMissed.MissedUpdates() {
+		t.Fatalf("Update returned `%v`, expected a missed updates error", err)
+	}
+
+	data, err := bus.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update after the missed updates: %v", err)
+	}
+
+	if _, ok := data["user/3/name"]; !ok || len(data) != 1000 {
+		t.Errorf("Update returned %d keys, expected all remaining 1000 messages starting with user/3/name", len(data))
+	}
+}
+
+func TestMemoryLogoutEvent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := messagebus.NewMemory()
+	bus.PublishLogout("session1")
+	bus.PublishLogout("session2", "session3")
+
+	got, err := bus.LogoutEvent(ctx)
+	if err != nil {
+		t.Fatalf("LogoutEvent: %v", err)
+	}
+
+	expect := []string{"session1", "session2", "session3"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("LogoutEvent returned %v, expected %v", got, expect)
+	}
+}
+
+func TestMemoryResumeAutoupdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := messagebus.NewMemory()
+	bus.Publish(map[string][]byte{"user/1/name": []byte(`"foo"`)})
+	if _, err := bus.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	id := bus.LastAutoupdateID()
+
+	bus.Publish(map[string][]byte{"user/2/name": []byte(`"bar"`)})
+	if _, err := bus.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	data, err := bus.ResumeAutoupdate(ctx, id)
+	if err != nil {
+		t.Fatalf("ResumeAutoupdate: %v", err)
+	}
+
+	expect := map[string][]byte{"user/2/name": []byte(`"bar"`)}
+	if !reflect.DeepEqual(data, expect) {
+		t.Errorf("ResumeAutoupdate returned %q, expected %q", data, expect)
+	}
+}
+
+func TestMemoryResumeAutoupdateOtherProcess(t *testing.T) {
+	bus := messagebus.NewMemory()
+
+	_, err := bus.ResumeAutoupdate(context.Background(), "12345-1")
+
+	var errMissed interface{ MissedUpdates() bool }
+	if !errors.As(err, &errMissed) || !errMissed.MissedUpdates() {
+		t.Errorf("ResumeAutoupdate returned `%v`, expected a missed updates error", err)
+	}
+}
@@ -0,0 +1,171 @@
+package messagebus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// Message is one message, that can be sent to the unix socket.
+//
+// ModifiedFields are the changed keys with their new values. A value of null
+// means, that the key was deleted. Logout are session ids, that were revoked.
+type Message struct {
+	ModifiedFields map[string]json.RawMessage `json:"modified_fields,omitempty"`
+	Logout         []string                   `json:"logout,omitempty"`
+}
+
+// publish sends the message to the bus.
+func (m Message) publish(bus *Memory) error {
+	if len(m.ModifiedFields) == 0 && len(m.Logout) == 0 {
+		return fmt.Errorf("message has no modified_fields and no logout")
+	}
+
+	if len(m.ModifiedFields) > 0 {
+		data := make(map[string][]byte, len(m.ModifiedFields))
+		for key, value := range m.ModifiedFields {
+			data[key] = value
+			if string(value) == "null" {
+				data[key] = nil
+			}
+		}
+		bus.Publish(data)
+	}
+
+	if len(m.Logout) > 0 {
+		bus.PublishLogout(m.Logout...)
+	}
+	return nil
+}
+
+// SocketListener receives messages from a unix socket and sends them to the
+// bus.
+//
+// Each message is a json encoded Message in one line. Each line is answered
+// with `ok` or with `error: ` and the error message.
+//
+// It has to be created with ListenSocket().
+type SocketListener struct {
+	listener net.Listener
+	bus      *Memory
+}
+
+// ListenSocket creates the unix socket. The connections are accepted, when
+// Serve() is called.
+//
+// Everyone, who can write to the socket, can change the data of the service.
+// So the socket file is only accessible by the user of the service.
+func ListenSocket(path string, bus *Memory) (*SocketListener, error) {
+	// Remove the socket file of a former process.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("removing old socket file: %w", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("set permissions of %s: %w", path, err)
+	}
+
+	return &SocketListener{listener: l, bus: bus}, nil
+}
+
+// Serve accepts connections on the socket. It blocks until the context is
+// done. Afterwards the socket is closed.
+func (s *SocketListener) Serve(ctx context.Context, errHandler func(error)) error {
+	if errHandler == nil {
+		errHandler = func(error) {}
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.listener.Close()
+	}()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accepting connection: %w", err)
+		}
+
+		go func() {
+			defer conn.Close()
+			if err := handleSocketConn(conn, s.bus); err != nil {
+				errHandler(fmt.Errorf("handling socket connection: %w", err))
+			}
+		}()
+	}
+}
+
+// handleSocketConn reads the messages from one connection.
+func handleSocketConn(conn io.ReadWriter, bus *Memory) error {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, 10<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		answer := "ok"
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			answer = fmt.Sprintf("error: invalid json: %v", err)
+		} else if err := msg.publish(bus); err != nil {
+			answer = fmt.Sprintf("error: %v", err)
+		}
+
+		if _, err := fmt.Fprintln(conn, answer); err != nil {
+			return fmt.Errorf("writing answer: %w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading messages: %w", err)
+	}
+	return nil
+}
+
+// SendSocket sends a message to a unix socket, that is served by
+// ListenSocket.
+func SendSocket(ctx context.Context, path string, msg Message) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", encoded); err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+
+	answer, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("reading answer: %w", err)
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer != "ok" {
+		return fmt.Errorf("message bus returned: %s", answer)
+	}
+	return nil
+}
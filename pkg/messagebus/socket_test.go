@@ -0,0 +1,94 @@
+package messagebus_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/messagebus"
+)
+
+func listenSocket(t *testing.T, bus *messagebus.Memory) string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	path := filepath.Join(t.TempDir(), "bus.sock")
+	listener, err := messagebus.ListenSocket(path, bus)
+	if err != nil {
+		t.Fatalf("ListenSocket: %v", err)
+	}
+
+	go listener.Serve(ctx, nil)
+	return path
+}
+
+func TestSocket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := messagebus.NewMemory()
+	path := listenSocket(t, bus)
+
+	msg := messagebus.Message{
+		ModifiedFields: map[string]json.RawMessage{
+			"user/1/name": json.RawMessage(`"foo"`),
+			"user/2/name": json.RawMessage(`null`),
+		},
+	}
+	if err := messagebus.SendSocket(ctx, path, msg); err != nil {
+		t.Fatalf("SendSocket: %v", err)
+	}
+
+	data, err := bus.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if string(data["user/1/name"]) != `"foo"` {
+		t.Errorf("user/1/name is %q, expected %q", data["user/1/name"], `"foo"`)
+	}
+
+	if v, ok := data["user/2/name"]; !ok || v != nil {
+		t.Errorf("user/2/name is %q, expected nil", v)
+	}
+}
+
+func TestSocketEmptyMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	path := listenSocket(t, messagebus.NewMemory())
+
+	err := messagebus.SendSocket(ctx, path, messagebus.Message{})
+
+	if err == nil || !strings.Contains(err.Error(), "no modified_fields") {
+		t.Errorf("SendSocket returned `%v`, expected an error about the empty message", err)
+	}
+}
+
+func TestListenSocketInvalidPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "bus.sock")
+
+	if _, err := messagebus.ListenSocket(path, messagebus.NewMemory()); err == nil {
+		t.Errorf("ListenSocket returned no error for a socket in a missing directory")
+	}
+}
+
+func TestListenSocketPermissions(t *testing.T) {
+	path := listenSocket(t, messagebus.NewMemory())
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Socket has permissions %o, expected 600", perm)
+	}
+}
@@ -2,7 +2,9 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -39,8 +41,46 @@ func (s *Pool) TestConn() error {
 }
 
 // XREAD reads new messages from one stream.
-func (s *Pool) XREAD(ctx context.Context, count, stream, id string) (interface{}, error) {
+//
+// If block is false, it returns nil, when there are no new messages.
+// Otherwise it waits for new messages.
+func (s *Pool) XREAD(ctx context.Context, count, stream, id string, block bool) (interface{}, error) {
 	conn := s.pool.Get()
 	defer conn.Close()
+
+	if !block {
+		return redis.DoContext(conn, ctx, "XREAD", "COUNT", count, "STREAMS", stream, id)
+	}
 	return redis.DoContext(conn, ctx, "XREAD", "COUNT", count, "BLOCK", "0", "STREAMS", stream, id)
 }
+
+// XINFOSTREAM returns information about a stream. It returns nil, if the
+// stream does not exist.
+func (s *Pool) XINFOSTREAM(ctx context.Context, stream string) (interface{}, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	reply, err := redis.DoContext(conn, ctx, "XINFO", "STREAM", stream)
+	var errRedis redis.Error
+	if errors.As(err, &errRedis) && strings.Contains(string(errRedis), "no such key") {
+		return nil, nil
+	}
+	return reply, err
+}
+
+// GET returns the value of a key. It returns nil, if the key does not exist.
+func (s *Pool) GET(ctx context.Context, key string) (interface{}, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	return redis.DoContext(conn, ctx, "GET", key)
+}
+
+// SET sets the value of a key.
+func (s *Pool) SET(ctx context.Context, key, value string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := redis.DoContext(conn, ctx, "SET", key, value)
+	return err
+}
@@ -0,0 +1,104 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IDStore saves the id of the last processed message from the autoupdate
+// stream. On a restart, the service continues after this id.
+type IDStore interface {
+	// LoadID returns the saved id. It is empty, if no id was saved.
+	LoadID(ctx context.Context) (string, error)
+
+	// SaveID saves the id.
+	SaveID(ctx context.Context, id string) error
+}
+
+// FileIDStore saves the message id in a local file.
+type FileIDStore struct {
+	Path string
+}
+
+// LoadID reads the id from the file. It is no error, if the file does not
+// exist.
+func (s FileIDStore) LoadID(ctx context.Context) (string, error) {
+	content, err := os.ReadFile(s.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading %s: %w", s.Path, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// SaveID writes the id to the file.
+//
+// A temporary file is used, so the old id is not lost, if writing fails.
+func (s FileIDStore) SaveID(ctx context.Context, id string) error {
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := fmt.Fprintln(f, id); err != nil {
+		return fmt.Errorf("writing id: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), s.Path); err != nil {
+		return fmt.Errorf("replacing %s: %w", s.Path, err)
+	}
+	return nil
+}
+
+// KeyValuer can read and write a redis key.
+type KeyValuer interface {
+	GET(ctx context.Context, key string) (interface{}, error)
+	SET(ctx context.Context, key, value string) error
+}
+
+// KeyIDStore saves the message id in a redis key.
+//
+// Each autoupdate instance needs its own key.
+type KeyIDStore struct {
+	Conn KeyValuer
+	Key  string
+}
+
+// LoadID reads the id from the redis key.
+func (s KeyIDStore) LoadID(ctx context.Context) (string, error) {
+	value, err := s.Conn.GET(ctx, s.Key)
+	if err != nil {
+		return "", fmt.Errorf("reading redis key %s: %w", s.Key, err)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid value in redis key %s: %v", s.Key, value)
+	}
+}
+
+// SaveID writes the id to the redis key.
+func (s KeyIDStore) SaveID(ctx context.Context, id string) error {
+	if err := s.Conn.SET(ctx, s.Key, id); err != nil {
+		return fmt.Errorf("writing redis key %s: %w", s.Key, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package redis_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/OpenSlides/openslides-autoupdate-service/pkg/redis"
+)
+
+func TestFileIDStore(t *testing.T) {
+	ctx := context.Background()
+	store := redis.FileIDStore{Path: filepath.Join(t.TempDir(), "last_id")}
+
+	id, err := store.LoadID(ctx)
+	if err != nil {
+		t.Fatalf("LoadID() without a file returned an unexpected error %v", err)
+	}
+
+	if id != "" {
+		t.Errorf("LoadID() without a file returned %s, expected an empty string", id)
+	}
+
+	if err := store.SaveID(ctx, "12345-0"); err != nil {
+		t.Fatalf("SaveID() returned an unexpected error %v", err)
+	}
+
+	id, err = store.LoadID(ctx)
+	if err != nil {
+		t.Fatalf("LoadID() returned an unexpected error %v", err)
+	}
+
+	if id != "12345-0" {
+		t.Errorf("LoadID() returned %s, expected 12345-0", id)
+	}
+}
+
+type keyValueMock map[string]string
+
+func (m keyValueMock) GET(ctx context.Context, key string) (interface{}, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(v), nil
+}
+
+func (m keyValueMock) SET(ctx context.Context, key, value string) error {
+	m[key] = value
+	return nil
+}
+
+func TestKeyIDStore(t *testing.T) {
+	ctx := context.Background()
+	conn := keyValueMock{}
+	store := redis.KeyIDStore{Conn: conn, Key: "autoupdate_last_id"}
+
+	if id, _ := store.LoadID(ctx); id != "" {
+		t.Errorf("LoadID() without a key returned %s, expected an empty string", id)
+	}
+
+	if err := store.SaveID(ctx, "12345-0"); err != nil {
+		t.Fatalf("SaveID() returned an unexpected error %v", err)
+	}
+
+	if conn["autoupdate_last_id"] != "12345-0" {
+		t.Errorf("Redis key contains %s, expected 12345-0", conn["autoupdate_last_id"])
+	}
+
+	id, err := store.LoadID(ctx)
+	if err != nil {
+		t.Fatalf("LoadID() returned an unexpected error %v", err)
+	}
+
+	if id != "12345-0" {
+		t.Errorf("LoadID() returned %s, expected 12345-0", id)
+	}
+}
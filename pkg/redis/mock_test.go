@@ -18,6 +18,14 @@ func getRedis() *redis.Redis {
 
 type mockConn struct {
 	err error
+
+	// first is the id of the first message in the stream. If it is empty,
+	// the stream is empty.
+	first string
+
+	// maxDeleted is the highest id that was removed from the stream. If it is
+	// empty, the mock behaves like redis before version 7.
+	maxDeleted string
 }
 
 var testData = map[string]string{
@@ -49,10 +57,13 @@ var testData = map[string]string{
 	]`,
 }
 
-func (c mockConn) XREAD(ctx context.Context, count, stream, lastID string) (interface{}, error) {
+func (c mockConn) XREAD(ctx context.Context, count, stream, lastID string, block bool) (interface{}, error) {
 	if c.err != nil {
 		return nil, c.err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if _, ok := testData[lastID]; !ok {
 		return nil, nil
 	}
@@ -61,6 +72,34 @@ func (c mockConn) XREAD(ctx context.Context, count, stream, lastID string) (inte
 	return data, err
 }
 
+func (c mockConn) XINFOSTREAM(ctx context.Context, stream string) (interface{}, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	var firstEntry interface{}
+	if c.first != "" {
+		firstEntry = []interface{}{c.first, []interface{}{}}
+	}
+
+	info := []interface{}{"length", int64(2), "first-entry", firstEntry}
+	if c.maxDeleted != "" {
+		info = append(info, "max-deleted-entry-id", c.maxDeleted)
+	}
+	return info, nil
+}
+
+// countingConn counts the calls to XINFOSTREAM.
+type countingConn struct {
+	redis.Connection
+	infoCalls int
+}
+
+func (c *countingConn) XINFOSTREAM(ctx context.Context, stream string) (interface{}, error) {
+	c.infoCalls++
+	return c.Connection.XINFOSTREAM(ctx, stream)
+}
+
 func cmpMap(one, two map[string][]byte) bool {
 	if len(one) != len(two) {
 		return false
@@ -73,3 +112,22 @@ func cmpMap(one, two map[string][]byte) bool {
 	}
 	return true
 }
+
+// memoryIDStore is an IDStore that holds the id in memory. If err is set,
+// saving fails.
+type memoryIDStore struct {
+	id  string
+	err error
+}
+
+func (s *memoryIDStore) LoadID(ctx context.Context) (string, error) {
+	return s.id, nil
+}
+
+func (s *memoryIDStore) SaveID(ctx context.Context, id string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.id = id
+	return nil
+}
@@ -5,6 +5,7 @@ package redis
 import (
 	"context"
 	"fmt"
+	"log"
 	"strconv"
 	"time"
 )
@@ -21,42 +22,272 @@ const (
 
 	// lastLogoutDuration decides how many old logout messages are received.
 	lastLogoutDuration = 15 * time.Minute
+
+	// saveIDInterval decides how often the id of the last message is saved
+	// in the IDStore.
+	saveIDInterval = time.Second
+
+	// saveIDTimeout is the time to save the id of the last message, when the
+	// service shuts down.
+	saveIDTimeout = time.Second
 )
 
 // Connection is the raw connection to a redis server.
 type Connection interface {
-	XREAD(ctx context.Context, count, stream, lastID string) (interface{}, error)
+	XREAD(ctx context.Context, count, stream, lastID string, block bool) (interface{}, error)
+	XINFOSTREAM(ctx context.Context, stream string) (interface{}, error)
 }
 
 // Redis holds the state of the redis receiver.
 type Redis struct {
-	Conn             Connection
+	Conn Connection
+
+	// IDStore is optional. If set, the id of the last message is saved and
+	// Update() continues after this id, when the service is restarted.
+	IDStore IDStore
+
 	lastAutoupdateID string
 	lastLogoutID     string
+
+	// autoupdateFailed is true, if reading the autoupdate stream failed before
+	// any message was received.
+	autoupdateFailed bool
+
+	// checkNeeded is true, if Update() has to check for missed messages
+	// before reading the stream. This is the case after the id was loaded
+	// from the IDStore or after reading the stream failed.
+	checkNeeded bool
+
+	idLoaded bool
+	savedID  string
+	savedAt  time.Time
 }
 
 // Update is a blocking function that returns, when there is new data.
+//
+// If messages could be missed, an error of type MissedUpdatesError is
+// returned. This happens, if the last read message was removed from the stream
+// or if reading failed before the first message was received.
 func (r *Redis) Update(ctx context.Context) (map[string][]byte, error) {
+	if err := r.loadID(ctx); err != nil {
+		return nil, err
+	}
+
+	if r.checkNeeded || r.autoupdateFailed {
+		if err := r.checkMissed(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	id := r.lastAutoupdateID
 	if id == "" {
 		id = "$"
 	}
 
-	id, data, err := autoupdateStream(r.Conn.XREAD(ctx, maxMessages, fieldChangedTopic, id))
+	id, data, err := autoupdateStream(r.Conn.XREAD(ctx, maxMessages, fieldChangedTopic, id, true))
 	if err != nil {
 		if err == errNil {
 			// No new data
 			return nil, nil
 		}
+
+		if ctx.Err() != nil {
+			// The service shuts down. Save the newest id, that was skipped
+			// because of the saveIDInterval.
+			saveCtx, cancel := context.WithTimeout(context.Background(), saveIDTimeout)
+			r.storeID(saveCtx)
+			cancel()
+		}
+
+		if ctx.Err() == nil {
+			if r.lastAutoupdateID == "" {
+				// Without a message id, it is not possible to continue where
+				// the reading failed.
+				r.autoupdateFailed = true
+			} else {
+				// The next message could be removed from the stream while
+				// redis was not reachable.
+				r.checkNeeded = true
+			}
+		}
 		return nil, fmt.Errorf("get xread data from redis: %w", err)
 	}
 
 	if id != "" {
 		r.lastAutoupdateID = id
+		r.saveID(ctx)
 	}
 	return data, nil
 }
 
+// loadID sets the last message id from the IDStore. It only does something on
+// the first call and only if the id was not set with ResumeAutoupdate().
+//
+// If the id can not be loaded, a MissedUpdatesError is returned.
+func (r *Redis) loadID(ctx context.Context) error {
+	if r.IDStore == nil || r.idLoaded {
+		return nil
+	}
+	r.idLoaded = true
+
+	if r.lastAutoupdateID != "" {
+		return nil
+	}
+
+	id, err := r.IDStore.LoadID(ctx)
+	if err != nil {
+		return MissedUpdatesError{reason: fmt.Sprintf("loading the last message id: %v", err)}
+	}
+
+	if id == "" {
+		return nil
+	}
+
+	if _, _, ok := parseID(id); !ok {
+		return MissedUpdatesError{reason: fmt.Sprintf("invalid saved message id %s", id)}
+	}
+
+	r.lastAutoupdateID = id
+	r.savedID = id
+	r.checkNeeded = true
+	return nil
+}
+
+// saveID saves the last message id in the IDStore, if the last save was longer
+// then saveIDInterval ago.
+func (r *Redis) saveID(ctx context.Context) {
+	if time.Since(r.savedAt) < saveIDInterval {
+		return
+	}
+	r.storeID(ctx)
+}
+
+// storeID saves the last message id in the IDStore.
+//
+// An error is only logged, so the current data is not lost. Messages are
+// idempotent. If the newest id was not saved, some messages are read again
+// after a restart.
+func (r *Redis) storeID(ctx context.Context) {
+	if r.IDStore == nil || r.savedID == r.lastAutoupdateID {
+		return
+	}
+
+	r.savedAt = time.Now()
+	if err := r.IDStore.SaveID(ctx, r.lastAutoupdateID); err != nil {
+		log.Printf("Error saving the last message id: %v", err)
+		return
+	}
+
+	r.savedID = r.lastAutoupdateID
+}
+
+// checkMissed returns a MissedUpdatesError, if messages after the last
+// message id were already removed from the stream.
+//
+// Since redis 7, the stream knows the highest removed id. With older versions,
+// it is only known, that the messages before the first message are gone. In
+// this case, an error is also returned, if only the last read message was
+// removed.
+//
+// The last message id is not changed, so the next call to Update() returns all
+// remaining messages.
+func (r *Redis) checkMissed(ctx context.Context) error {
+	if r.autoupdateFailed {
+		r.autoupdateFailed = false
+		return MissedUpdatesError{reason: "reading the stream failed before the first message"}
+	}
+
+	if r.lastAutoupdateID == "" {
+		r.checkNeeded = false
+		return nil
+	}
+
+	first, maxDeleted, err := streamInfo(r.Conn.XINFOSTREAM(ctx, fieldChangedTopic))
+	if err != nil {
+		if err == errNil {
+			// The stream does not exist.
+			r.checkNeeded = false
+			return nil
+		}
+		return fmt.Errorf("get stream info from redis: %w", err)
+	}
+	r.checkNeeded = false
+
+	if maxDeleted != "" {
+		if idLess(r.lastAutoupdateID, maxDeleted) {
+			return MissedUpdatesError{reason: fmt.Sprintf("messages after %s were removed from the stream up to %s", r.lastAutoupdateID, maxDeleted)}
+		}
+		return nil
+	}
+
+	if first != "" && idLess(r.lastAutoupdateID, first) {
+		return MissedUpdatesError{reason: fmt.Sprintf("message %s was removed from the stream. First message is %s", r.lastAutoupdateID, first)}
+	}
+	return nil
+}
+
+// MissedUpdatesError is returned by Update(), when messages from the stream
+// could be missed.
+type MissedUpdatesError struct {
+	reason string
+}
+
+func (e MissedUpdatesError) Error() string {
+	return fmt.Sprintf("updates could be missed: %s", e.reason)
+}
+
+// MissedUpdates tells the datastore, that the values could be outdated.
+func (e MissedUpdatesError) MissedUpdates() bool {
+	return true
+}
+
+// LastAutoupdateID returns the id of the last message, that was returned by
+// Update(). It is empty, if Update() did not return a message yet.
+//
+// It must not be called at the same time as Update().
+func (r *Redis) LastAutoupdateID() string {
+	return r.lastAutoupdateID
+}
+
+// ResumeAutoupdate returns the changes from all messages after the given id,
+// that are currently in the stream. It does not block. Afterwards, Update()
+// returns the messages after the last returned message.
+//
+// It must not be called at the same time as Update().
+//
+// If messages after the id were already removed from the stream, a
+// MissedUpdatesError is returned.
+func (r *Redis) ResumeAutoupdate(ctx context.Context, id string) (map[string][]byte, error) {
+	r.lastAutoupdateID = id
+	if err := r.checkMissed(ctx); err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string][]byte)
+	for {
+		newID, data, err := autoupdateStream(r.Conn.XREAD(ctx, maxMessages, fieldChangedTopic, id, false))
+		if err != nil {
+			if err == errNil {
+				// No more data
+				break
+			}
+			return nil, fmt.Errorf("get xread data from redis: %w", err)
+		}
+
+		if newID == "" {
+			break
+		}
+
+		for k, v := range data {
+			changes[k] = v
+		}
+		id = newID
+	}
+
+	r.lastAutoupdateID = id
+	return changes, nil
+}
+
 // LogoutEvent is a blocking function that returns, when a session was revoked.
 func (r *Redis) LogoutEvent(ctx context.Context) ([]string, error) {
 	id := r.lastLogoutID
@@ -65,7 +296,7 @@ func (r *Redis) LogoutEvent(ctx context.Context) ([]string, error) {
 		id = strconv.FormatInt(time.Now().Add(-lastLogoutDuration).Unix(), 10)
 	}
 
-	id, sessionIDs, err := logoutStream(r.Conn.XREAD(ctx, maxMessages, logoutTopic, id))
+	id, sessionIDs, err := logoutStream(r.Conn.XREAD(ctx, maxMessages, logoutTopic, id, true))
 	if err != nil {
 		if err == errNil {
 			// No new data
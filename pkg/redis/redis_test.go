@@ -64,3 +64,221 @@ func TestRedisError(t *testing.T) {
 		t.Errorf("Update() returned %v, expected no keys.", keys)
 	}
 }
+
+func TestResumeAutoupdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := getRedis()
+	data, err := r.ResumeAutoupdate(ctx, "12345-0")
+	if err != nil {
+		t.Fatalf("ResumeAutoupdate() returned an unexpected error %v", err)
+	}
+
+	expect := map[string][]byte{
+		"user/1/name": []byte("Hubert"),
+		"user/3/name": []byte("Igor"),
+	}
+	if !cmpMap(data, expect) {
+		t.Errorf("ResumeAutoupdate() returned %v, expected %v", data, expect)
+	}
+
+	if got := r.LastAutoupdateID(); got != "12346-0" {
+		t.Errorf("LastAutoupdateID() returned %s, expected 12346-0", got)
+	}
+}
+
+func TestResumeAutoupdateTrimmedStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &redis.Redis{Conn: mockConn{first: "12347-0", maxDeleted: "12346-0"}}
+	_, err := r.ResumeAutoupdate(ctx, "12345-0")
+
+	var errMissed redis.MissedUpdatesError
+	if !errors.As(err, &errMissed) {
+		t.Fatalf("ResumeAutoupdate() returned error %v, expected a MissedUpdatesError", err)
+	}
+
+	// The next call returns the remaining messages.
+	data, err := r.Update(ctx)
+	if err != nil {
+		t.Errorf("Update() returned an unexpected error %v", err)
+	}
+
+	expect := map[string][]byte{
+		"user/1/name": []byte("Hubert"),
+		"user/3/name": []byte("Igor"),
+	}
+	if !cmpMap(data, expect) {
+		t.Errorf("Update() returned %v, expected %v", data, expect)
+	}
+}
+
+func TestResumeAutoupdateOnlyLastIDTrimmed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &redis.Redis{Conn: mockConn{first: "12346-0", maxDeleted: "12345-0"}}
+	data, err := r.ResumeAutoupdate(ctx, "12345-0")
+	if err != nil {
+		t.Fatalf("ResumeAutoupdate() returned an unexpected error %v", err)
+	}
+
+	expect := map[string][]byte{
+		"user/1/name": []byte("Hubert"),
+		"user/3/name": []byte("Igor"),
+	}
+	if !cmpMap(data, expect) {
+		t.Errorf("ResumeAutoupdate() returned %v, expected %v", data, expect)
+	}
+}
+
+func TestUpdateFailedBeforeFirstMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &redis.Redis{Conn: mockConn{err: errors.New("my error")}}
+	if _, err := r.Update(ctx); err == nil {
+		t.Fatalf("Update() did not return an error")
+	}
+
+	r.Conn = mockConn{}
+	_, err := r.Update(ctx)
+
+	var errMissed redis.MissedUpdatesError
+	if !errors.As(err, &errMissed) {
+		t.Fatalf("Update() returned error %v, expected a MissedUpdatesError", err)
+	}
+
+	data, err := r.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update() returned an unexpected error %v", err)
+	}
+
+	if len(data) != 3 {
+		t.Errorf("Update() returned %v, expected the data from the stream", data)
+	}
+}
+
+func TestUpdateResumesFromIDStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &memoryIDStore{id: "12345-0"}
+	r := &redis.Redis{Conn: mockConn{}, IDStore: store}
+
+	data, err := r.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update() returned an unexpected error %v", err)
+	}
+
+	expect := map[string][]byte{
+		"user/1/name": []byte("Hubert"),
+		"user/3/name": []byte("Igor"),
+	}
+	if !cmpMap(data, expect) {
+		t.Errorf("Update() returned %v, expected %v", data, expect)
+	}
+
+	if store.id != "12346-0" {
+		t.Errorf("IDStore contains %s, expected 12346-0", store.id)
+	}
+}
+
+func TestUpdateChecksStreamOnlyAfterLoadingID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := &countingConn{Connection: mockConn{first: "12345-0"}}
+	r := &redis.Redis{Conn: conn, IDStore: &memoryIDStore{id: "12345-0"}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Update(ctx); err != nil {
+			t.Fatalf("Update() returned an unexpected error %v", err)
+		}
+	}
+
+	if conn.infoCalls != 1 {
+		t.Errorf("XINFO STREAM was called %d times, expected 1", conn.infoCalls)
+	}
+}
+
+func TestUpdateIDStoreSaveError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &redis.Redis{Conn: mockConn{}, IDStore: &memoryIDStore{err: errors.New("disk full")}}
+
+	data, err := r.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update() returned an unexpected error %v", err)
+	}
+
+	if len(data) != 3 {
+		t.Errorf("Update() returned %v, expected the data from the stream", data)
+	}
+
+	if _, err := r.Update(ctx); err != nil {
+		t.Errorf("Second Update() returned an unexpected error %v", err)
+	}
+}
+
+func TestUpdateSavesIDOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	store := &memoryIDStore{}
+	r := &redis.Redis{Conn: mockConn{}, IDStore: store}
+
+	// ResumeAutoupdate moves the id without saving it.
+	if _, err := r.ResumeAutoupdate(ctx, "12345-0"); err != nil {
+		t.Fatalf("ResumeAutoupdate() returned an unexpected error %v", err)
+	}
+
+	cancel()
+	if _, err := r.Update(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Update() returned error %v, expected context.Canceled", err)
+	}
+
+	if store.id != "12346-0" {
+		t.Errorf("IDStore contains `%s`, expected 12346-0", store.id)
+	}
+}
+
+func TestUpdateIDStoreTooOld(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &redis.Redis{Conn: mockConn{first: "12346-0"}, IDStore: &memoryIDStore{id: "12345-0"}}
+
+	_, err := r.Update(ctx)
+
+	var errMissed redis.MissedUpdatesError
+	if !errors.As(err, &errMissed) {
+		t.Fatalf("Update() returned error %v, expected a MissedUpdatesError", err)
+	}
+}
+
+func TestUpdateIDStoreInvalidID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &redis.Redis{Conn: mockConn{}, IDStore: &memoryIDStore{id: "invalid"}}
+
+	_, err := r.Update(ctx)
+
+	var errMissed redis.MissedUpdatesError
+	if !errors.As(err, &errMissed) {
+		t.Fatalf("Update() returned error %v, expected a MissedUpdatesError", err)
+	}
+
+	// The next call reads new messages.
+	data, err := r.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update() returned an unexpected error %v", err)
+	}
+
+	if len(data) != 3 {
+		t.Errorf("Update() returned %v, expected the data from the stream", data)
+	}
+}
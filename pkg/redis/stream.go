@@ -3,6 +3,8 @@ package redis
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 var errNil = errors.New("nil returned")
@@ -103,6 +105,97 @@ func logoutStream(reply interface{}, err error) (string, []string, error) {
 	return id, sessionIDs, nil
 }
 
+// streamInfo parses the reply of an XINFO STREAM command. It returns the id of
+// the first entry and the highest id that was removed from the stream.
+//
+// first is empty, if the stream is empty. maxDeleted is empty, if redis is
+// older then version 7. Returns errNil, if the stream does not exist.
+func streamInfo(reply interface{}, err error) (first string, maxDeleted string, _ error) {
+	if err != nil {
+		return "", "", err
+	}
+
+	if reply == nil {
+		return "", "", errNil
+	}
+
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields)%2 != 0 {
+		return "", "", fmt.Errorf("invalid input. Data has to be a list of key value pairs, not %T", reply)
+	}
+
+	for i := 0; i < len(fields); i += 2 {
+		key, ok := tostr(fields[i])
+		if !ok {
+			return "", "", fmt.Errorf("invalid input. Key has to be a string, got %T", fields[i])
+		}
+
+		switch key {
+		case "first-entry":
+			if fields[i+1] == nil {
+				continue
+			}
+
+			entry, ok := fields[i+1].([]interface{})
+			if !ok || len(entry) != 2 {
+				return "", "", fmt.Errorf("invalid input. Stream element has to be a two-tuple")
+			}
+
+			first, ok = tostr(entry[0])
+			if !ok {
+				return "", "", fmt.Errorf("invalid input. Stream ID has to be a string, got %T", entry[0])
+			}
+
+		case "max-deleted-entry-id":
+			maxDeleted, ok = tostr(fields[i+1])
+			if !ok {
+				return "", "", fmt.Errorf("invalid input. Deleted ID has to be a string, got %T", fields[i+1])
+			}
+		}
+	}
+
+	return first, maxDeleted, nil
+}
+
+// idLess returns true, if the stream id a is lower then b.
+//
+// Returns false, if one of the ids is invalid.
+func idLess(a, b string) bool {
+	aMS, aSeq, ok := parseID(a)
+	if !ok {
+		return false
+	}
+
+	bMS, bSeq, ok := parseID(b)
+	if !ok {
+		return false
+	}
+
+	if aMS != bMS {
+		return aMS < bMS
+	}
+	return aSeq < bSeq
+}
+
+// parseID splits a stream id in the form `milliseconds-sequence`.
+func parseID(id string) (ms uint64, seq uint64, ok bool) {
+	rawMS, rawSeq, found := strings.Cut(id, "-")
+	if !found {
+		rawSeq = "0"
+	}
+
+	ms, err := strconv.ParseUint(rawMS, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	seq, err = strconv.ParseUint(rawSeq, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
 // tostr converts an interface with value string or []byte to string this is an
 // helper, because the test-code generates strings but the redis code generates
 // []bytes.
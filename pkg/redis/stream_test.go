@@ -99,3 +99,60 @@ func cmpMap(one, two map[string][]byte) bool {
 	}
 	return true
 }
+
+func TestIDLess(t *testing.T) {
+	for _, tt := range []struct {
+		a, b   string
+		expect bool
+	}{
+		{"1-0", "2-0", true},
+		{"2-0", "1-0", false},
+		{"1-1", "1-2", true},
+		{"1-2", "1-2", false},
+		{"9-0", "10-0", true},
+		{"1", "1-1", true},
+		{"invalid", "1-0", false},
+	} {
+		if got := idLess(tt.a, tt.b); got != tt.expect {
+			t.Errorf("idLess(%s, %s) = %t, expected %t", tt.a, tt.b, got, tt.expect)
+		}
+	}
+}
+
+func TestStreamInfo(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		reply      interface{}
+		first      string
+		maxDeleted string
+		err        error
+	}{
+		{"no stream", nil, "", "", errNil},
+		{"empty stream", []interface{}{[]byte("length"), int64(0), []byte("first-entry"), nil}, "", "", nil},
+		{
+			"redis 6",
+			[]interface{}{[]byte("length"), int64(1), []byte("first-entry"), []interface{}{[]byte("12345-0"), []interface{}{}}},
+			"12345-0",
+			"",
+			nil,
+		},
+		{
+			"redis 7",
+			[]interface{}{[]byte("max-deleted-entry-id"), []byte("12344-0"), []byte("first-entry"), []interface{}{[]byte("12345-0"), []interface{}{}}},
+			"12345-0",
+			"12344-0",
+			nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			first, maxDeleted, err := streamInfo(tt.reply, nil)
+			if err != tt.err {
+				t.Fatalf("streamInfo() returned error %v, expected %v", err, tt.err)
+			}
+
+			if first != tt.first || maxDeleted != tt.maxDeleted {
+				t.Errorf("streamInfo() returned (%s, %s), expected (%s, %s)", first, maxDeleted, tt.first, tt.maxDeleted)
+			}
+		})
+	}
+}